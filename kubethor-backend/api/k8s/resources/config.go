@@ -1,6 +1,7 @@
 package resources
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,6 +13,8 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // Unmarshal the JSON request body into the resourceData object for Create and Update Resource
@@ -79,7 +82,7 @@ func UnmarshalJSONResourceRequestBody(r *http.Request, resourceType string) (int
 		}
 		resourceData = &endpoint
 	case "ServiceAccount":
-		var serviceaccount corev1.Endpoints
+		var serviceaccount corev1.ServiceAccount
 		if err := json.Unmarshal(requestBody, &serviceaccount); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal JSON request for resource type %s: %s", resourceType, err.Error())
 		}
@@ -109,8 +112,29 @@ func UnmarshalJSONResourceRequestBody(r *http.Request, resourceType string) (int
 		}
 		resourceData = &event
 	default:
-		return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
+		// Any other kind is sent through the dynamic client as an unstructured object
+		var object unstructured.Unstructured
+		if err := json.Unmarshal(requestBody, &object.Object); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON request for resource type %s: %s", resourceType, err.Error())
+		}
+		resourceData = &object
 	}
 
 	return resourceData, nil
 }
+
+// k8sErrorStatus maps the errors of a request to the API server, and our own container lookups, to HTTP status codes
+func k8sErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrContainerNotFound) || apierrors.IsNotFound(err):
+		return http.StatusNotFound
+	case errors.Is(err, ErrContainerExists) || apierrors.IsConflict(err):
+		return http.StatusConflict
+	case apierrors.IsForbidden(err):
+		return http.StatusForbidden
+	case apierrors.IsInvalid(err) || apierrors.IsBadRequest(err):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,245 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	k8sclient "kubethor-backend/api"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Characters an imported key can't have in an env var name, like kubectl set env --from replaces them
+var invalidEnvNameCharacters = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// EnvImport imports the keys of a ConfigMap or Secret as env vars that reference them.
+// Keys limits the import to some keys, Prefix is put in front of every env var name.
+type EnvImport struct {
+	Kind   string   `json:"kind"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix,omitempty"`
+	Keys   []string `json:"keys,omitempty"`
+}
+
+// SetEnvRequest is the body of an env request. Set values override imported env vars of the same name.
+type SetEnvRequest struct {
+	Set   map[string]string `json:"set,omitempty"`
+	Unset []string          `json:"unset,omitempty"`
+	From  []EnvImport       `json:"from,omitempty"`
+}
+
+// SetEnvResponse represents the JSON response of an env change, the env vars set and the ones removed.
+type SetEnvResponse struct {
+	Namespace string   `json:"namespace"`
+	Kind      string   `json:"kind"`
+	Name      string   `json:"name"`
+	Container string   `json:"container"`
+	Set       []string `json:"set"`
+	Unset     []string `json:"unset"`
+	Status    bool     `json:"status"`
+	Message   string   `json:"message,omitempty"`
+}
+
+// K8sSetContainerEnv sets, unsets and imports env vars of a container or init container, like kubectl set env,
+// with a strategic merge patch of its env list so the other env vars are kept.
+func K8sSetContainerEnv(ctx context.Context, sessionID, namespace, resourceType, name, containerName string, request SetEnvRequest) (*SetEnvResponse, error) {
+	resource, object, kind, podSpecPath, err := k8sGetPodSpecResource(ctx, sessionID, namespace, resourceType, name)
+	if err != nil {
+		return nil, err
+	}
+	field, container, err := findPodSpecContainer(object, kind, podSpecPath, containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Env var name -> patch entry, a value replaces a valueFrom and the other way around
+	env := map[string]map[string]interface{}{}
+	for _, envImport := range request.From {
+		references, err := k8sEnvImportReferences(ctx, sessionID, namespace, envImport)
+		if err != nil {
+			return nil, err
+		}
+		for envName, valueFrom := range references {
+			env[envName] = map[string]interface{}{"name": envName, "value": nil, "valueFrom": valueFrom}
+		}
+	}
+	for envName, value := range request.Set {
+		env[envName] = map[string]interface{}{"name": envName, "value": value, "valueFrom": nil}
+	}
+
+	response := &SetEnvResponse{Namespace: namespace, Kind: kind, Name: name, Container: containerName, Set: []string{}, Unset: []string{}, Status: true}
+	entries := []interface{}{}
+	for envName := range env {
+		response.Set = append(response.Set, envName)
+	}
+	sort.Strings(response.Set)
+	for _, envName := range response.Set {
+		entries = append(entries, env[envName])
+	}
+
+	// Only env vars the container has are removed
+	existing := map[string]bool{}
+	if containerEnv, ok := container["env"].([]interface{}); ok {
+		for _, item := range containerEnv {
+			if envVar, ok := item.(map[string]interface{}); ok {
+				if envName, ok := envVar["name"].(string); ok {
+					existing[envName] = true
+				}
+			}
+		}
+	}
+	for _, envName := range request.Unset {
+		if _, ok := env[envName]; ok {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("env var %s can't be both set and unset", envName))
+		}
+		if existing[envName] {
+			response.Unset = append(response.Unset, envName)
+			entries = append(entries, map[string]interface{}{"name": envName, "$patch": "delete"})
+		}
+	}
+
+	if len(entries) == 0 {
+		response.Message = fmt.Sprintf("env of %s in %s %s is unchanged", containerName, kind, name)
+		return response, nil
+	}
+
+	patch, err := podSpecPatch(podSpecPath, object.GetResourceVersion(), map[string][]interface{}{
+		field: {map[string]interface{}{"name": containerName, "env": entries}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resource.Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return nil, err
+	}
+
+	response.Message = fmt.Sprintf("env of %s in %s %s successfully updated", containerName, kind, name)
+	return response, nil
+}
+
+// k8sEnvImportReferences reads the keys of the ConfigMap or Secret and returns the valueFrom of the env var of every key
+func k8sEnvImportReferences(ctx context.Context, sessionID, namespace string, envImport EnvImport) (map[string]interface{}, error) {
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if clientset is properly initialized
+	if userData.Clientset == nil {
+		return nil, fmt.Errorf("clientset is nil, clientset not properly initialized")
+	}
+
+	var keys []string
+	var referenceField string
+	switch strings.ToLower(envImport.Kind) {
+	case "configmap":
+		configMap, err := userData.Clientset.CoreV1().ConfigMaps(namespace).Get(ctx, envImport.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for key := range configMap.Data {
+			keys = append(keys, key)
+		}
+		for key := range configMap.BinaryData {
+			keys = append(keys, key)
+		}
+		referenceField = "configMapKeyRef"
+	case "secret":
+		secret, err := userData.Clientset.CoreV1().Secrets(namespace).Get(ctx, envImport.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for key := range secret.Data {
+			keys = append(keys, key)
+		}
+		referenceField = "secretKeyRef"
+	default:
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid import kind: %s, must be ConfigMap or Secret", envImport.Kind))
+	}
+
+	if len(envImport.Keys) > 0 {
+		found := map[string]bool{}
+		for _, key := range keys {
+			found[key] = true
+		}
+		for _, key := range envImport.Keys {
+			if !found[key] {
+				return nil, apierrors.NewBadRequest(fmt.Sprintf("key %s not found in %s %s", key, envImport.Kind, envImport.Name))
+			}
+		}
+		keys = envImport.Keys
+	}
+
+	references := map[string]interface{}{}
+	for _, key := range keys {
+		envName := envImport.Prefix + strings.ToUpper(invalidEnvNameCharacters.ReplaceAllString(key, "_"))
+		references[envName] = map[string]interface{}{
+			referenceField: map[string]interface{}{"name": envImport.Name, "key": key},
+		}
+	}
+	return references, nil
+}
+
+// SetContainerEnv sets, unsets or imports env vars of a container of a workload or pod.
+func SetContainerEnv(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get("X-Session-Id")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	resourceType := vars["resource_type"]
+	namespaceName := vars["namespace_name"]
+	resourceName := vars["resource_name"]
+	containerName := vars["container_name"]
+
+	var request SetEnvRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("failed to unmarshal JSON request: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if len(request.Set) == 0 && len(request.Unset) == 0 && len(request.From) == 0 {
+		http.Error(w, "at least one of set, unset or from must be provided", http.StatusBadRequest)
+		return
+	}
+	for envName := range request.Set {
+		if envName == "" {
+			http.Error(w, "env var names must not be empty", http.StatusBadRequest)
+			return
+		}
+	}
+	for _, envName := range request.Unset {
+		if _, ok := request.Set[envName]; ok {
+			http.Error(w, fmt.Sprintf("env var %s can't be both set and unset", envName), http.StatusBadRequest)
+			return
+		}
+	}
+	for _, envImport := range request.From {
+		if envImport.Name == "" {
+			http.Error(w, "every import must have a name", http.StatusBadRequest)
+			return
+		}
+	}
+
+	response, err := K8sSetContainerEnv(r.Context(), sessionID, namespaceName, resourceType, resourceName, containerName, request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error updating env of %s: %s: %s", resourceType, resourceName, err.Error()), k8sErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding JSON response: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+}
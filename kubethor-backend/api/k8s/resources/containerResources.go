@@ -0,0 +1,138 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SetResourcesRequest is the body of a resources request, quantities by resource name, e.g. {"cpu": "250m"}.
+// An empty quantity removes the request or limit.
+type SetResourcesRequest struct {
+	Requests map[string]string `json:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty"`
+}
+
+// SetResourcesResponse represents the JSON response of a resources change, with the requests and limits
+// the container has afterwards.
+type SetResourcesResponse struct {
+	Namespace string            `json:"namespace"`
+	Kind      string            `json:"kind"`
+	Name      string            `json:"name"`
+	Container string            `json:"container"`
+	Requests  map[string]string `json:"requests"`
+	Limits    map[string]string `json:"limits"`
+	Status    bool              `json:"status"`
+	Message   string            `json:"message,omitempty"`
+}
+
+// K8sSetContainerResources sets the requests and limits of a container or init container, like kubectl set resources,
+// with a strategic merge patch so the other requests and limits are kept.
+func K8sSetContainerResources(ctx context.Context, sessionID, namespace, resourceType, name, containerName string, request SetResourcesRequest) (*SetResourcesResponse, error) {
+	resourcesPatch := map[string]interface{}{}
+	for field, quantities := range map[string]map[string]string{"requests": request.Requests, "limits": request.Limits} {
+		if len(quantities) == 0 {
+			continue
+		}
+		patchQuantities := map[string]interface{}{}
+		for resourceName, quantity := range quantities {
+			if quantity == "" {
+				patchQuantities[resourceName] = nil
+				continue
+			}
+			parsed, err := resource.ParseQuantity(quantity)
+			if err != nil {
+				return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid %s %s: %s", field, resourceName, err.Error()))
+			}
+			patchQuantities[resourceName] = parsed.String()
+		}
+		resourcesPatch[field] = patchQuantities
+	}
+
+	podSpecResource, object, kind, podSpecPath, err := k8sGetPodSpecResource(ctx, sessionID, namespace, resourceType, name)
+	if err != nil {
+		return nil, err
+	}
+	field, _, err := findPodSpecContainer(object, kind, podSpecPath, containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := podSpecPatch(podSpecPath, object.GetResourceVersion(), map[string][]interface{}{
+		field: {map[string]interface{}{"name": containerName, "resources": resourcesPatch}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	updated, err := podSpecResource.Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SetResourcesResponse{
+		Namespace: namespace,
+		Kind:      kind,
+		Name:      name,
+		Container: containerName,
+		Requests:  map[string]string{},
+		Limits:    map[string]string{},
+		Status:    true,
+		Message:   fmt.Sprintf("resources of %s in %s %s successfully updated", containerName, kind, name),
+	}
+	if _, container, err := findPodSpecContainer(updated, kind, podSpecPath, containerName); err == nil {
+		containerResources, _ := container["resources"].(map[string]interface{})
+		for field, quantities := range map[string]map[string]string{"requests": response.Requests, "limits": response.Limits} {
+			values, _ := containerResources[field].(map[string]interface{})
+			for resourceName, quantity := range values {
+				quantities[resourceName] = fmt.Sprint(quantity)
+			}
+		}
+	}
+	return response, nil
+}
+
+// SetContainerResources sets the requests and limits of a container of a workload or pod.
+func SetContainerResources(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get("X-Session-Id")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	resourceType := vars["resource_type"]
+	namespaceName := vars["namespace_name"]
+	resourceName := vars["resource_name"]
+	containerName := vars["container_name"]
+
+	var request SetResourcesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("failed to unmarshal JSON request: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if len(request.Requests) == 0 && len(request.Limits) == 0 {
+		http.Error(w, "at least one of requests or limits must be provided", http.StatusBadRequest)
+		return
+	}
+
+	response, err := K8sSetContainerResources(r.Context(), sessionID, namespaceName, resourceType, resourceName, containerName, request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error updating resources of %s: %s: %s", resourceType, resourceName, err.Error()), k8sErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding JSON response: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+}
@@ -11,6 +11,8 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // CreateResource creates a new resource.
@@ -33,9 +35,27 @@ func K8sCreateResource(sessionID, namespace, resourceType string, resourceData i
 		return userData.Clientset.AppsV1().Deployments(namespace).Create(context.TODO(), resourceData.(*appsv1.Deployment), metav1.CreateOptions{})
 	case "ConfigMap":
 		return userData.Clientset.CoreV1().ConfigMaps(namespace).Create(context.TODO(), resourceData.(*corev1.ConfigMap), metav1.CreateOptions{})
-	// Add cases for other resource types as needed
 	default:
-		return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
+		// Any other kind (StatefulSet, DaemonSet, CRDs, ...) is resolved through discovery
+		resource, mapping, err := k8sclient.GetDynamicResource(userData, resourceType, namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		// Kinds without a typed create above may still be decoded into their typed object
+		object, ok := resourceData.(*unstructured.Unstructured)
+		if !ok {
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(resourceData)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected type for resource type %s: %s", resourceType, err.Error())
+			}
+			object = &unstructured.Unstructured{Object: content}
+		}
+		// The body may leave out apiVersion and kind, the dynamic client can't encode the object without them
+		if object.GetKind() == "" {
+			object.SetGroupVersionKind(mapping.GroupVersionKind)
+		}
+		return resource.Create(context.TODO(), object, metav1.CreateOptions{})
 	}
 }
 
@@ -130,9 +130,18 @@ func K8sDeleteResource(sessionID, namespace, name, resourceType string) (*K8sDel
 			return resp, err
 		}
 	default:
-		resp.Status = false
-		resp.Message = fmt.Sprintf("unsupported resource type: %s", resourceType)
-		return resp, fmt.Errorf("unsupported resource type: %s", resourceType)
+		// Any other kind (StatefulSet, DaemonSet, CRDs, ...) is resolved through discovery
+		resource, _, err := k8sclient.GetDynamicResource(userData, resourceType, namespace)
+		if err != nil {
+			resp.Status = false
+			resp.Message = err.Error()
+			return resp, err
+		}
+		if err := resource.Delete(context.TODO(), name, deleteOptions); err != nil {
+			resp.Status = false
+			resp.Message = err.Error()
+			return resp, err
+		}
 	}
 
 	resp.Status = true
@@ -8,11 +8,15 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // FetchResource fetches a resource by name and type.
-func K8sGetListResource(sessionID, namespace, resourceType string) (interface{}, error) {
+// The reserved namespace "_all" lists across all namespaces, falling back to the namespaces
+// the user can list when RBAC forbids cluster-wide access.
+func K8sGetListResource(sessionID, namespace, resourceType string, selector k8sclient.ResourceSelector) (interface{}, error) {
 	// Retrieve user data using session ID
 	userData, err := k8sclient.GetSession(sessionID)
 	if err != nil {
@@ -24,16 +28,69 @@ func K8sGetListResource(sessionID, namespace, resourceType string) (interface{},
 		return nil, fmt.Errorf("clientset is nil, clientset not properly initialized")
 	}
 
+	listNamespace := namespace
+	if namespace == k8sclient.AllNamespaces {
+		listNamespace = metav1.NamespaceAll
+	}
+
+	// Serve from the session's informer cache when a watcher already keeps this kind/namespace in sync
+	if cachedList, ok := k8sclient.GetCachedResourceList(userData, resourceType, listNamespace, selector); ok {
+		return cachedList, nil
+	}
+
+	// Label and field selectors are applied server-side
+	listOptions := selector.ListOptions()
+
+	resourceList, err := k8sListResource(userData, listNamespace, resourceType, listOptions)
+	if namespace == k8sclient.AllNamespaces && errors.IsForbidden(err) {
+		return k8sListResourceAccessibleNamespaces(userData, resourceType, listOptions, err)
+	}
+	return resourceList, err
+}
+
+func k8sListResource(userData *k8sclient.UserData, namespace, resourceType string, listOptions metav1.ListOptions) (interface{}, error) {
 	switch resourceType {
 	case "Pod":
-		return userData.Clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+		return userData.Clientset.CoreV1().Pods(namespace).List(context.TODO(), listOptions)
 	case "Deployment":
-		return userData.Clientset.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
+		return userData.Clientset.AppsV1().Deployments(namespace).List(context.TODO(), listOptions)
 	case "ConfigMap":
-		return userData.Clientset.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{})
+		return userData.Clientset.CoreV1().ConfigMaps(namespace).List(context.TODO(), listOptions)
 	default:
-		return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
+		// Any other kind (StatefulSet, DaemonSet, CRDs, ...) is resolved through discovery
+		resource, _, err := k8sclient.GetDynamicResource(userData, resourceType, namespace)
+		if err != nil {
+			return nil, err
+		}
+		return resource.List(context.TODO(), listOptions)
+	}
+}
+
+// k8sListResourceAccessibleNamespaces merges the lists of every namespace the user may list, skipping forbidden ones.
+func k8sListResourceAccessibleNamespaces(userData *k8sclient.UserData, resourceType string, listOptions metav1.ListOptions, forbiddenErr error) (interface{}, error) {
+	mergedList := &unstructured.UnstructuredList{Object: map[string]interface{}{"apiVersion": "v1", "kind": "List"}}
+	listed := false
+
+	for _, namespace := range k8sclient.GetSessionNamespaces(userData) {
+		resource, _, err := k8sclient.GetDynamicResource(userData, resourceType, namespace)
+		if err != nil {
+			return nil, err
+		}
+		namespaceList, err := resource.List(context.TODO(), listOptions)
+		if errors.IsForbidden(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		listed = true
+		mergedList.Items = append(mergedList.Items, namespaceList.Items...)
+	}
+
+	if !listed {
+		return nil, forbiddenErr
 	}
+	return mergedList, nil
 }
 
 func GetListResource(w http.ResponseWriter, r *http.Request) {
@@ -52,8 +109,14 @@ func GetListResource(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	selector, err := k8sclient.GetResourceSelector(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Fetch the resource data as a JSON byte slice
-	resourceData, err := K8sGetListResource(sessionID, namespaceName, resourceType)
+	resourceData, err := K8sGetListResource(sessionID, namespaceName, resourceType, selector)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error getting %s info: %s", resourceType, err.Error()), http.StatusInternalServerError)
 		return
@@ -23,6 +23,11 @@ func K8sFetchResource(sessionID, namespace, name, resourceType string) (interfac
 		return nil, fmt.Errorf("clientset is nil, clientset not properly initialized")
 	}
 
+	// Serve from the session's informer cache when a watcher already keeps this kind/namespace in sync
+	if cachedResource, ok := k8sclient.GetCachedResource(userData, resourceType, namespace, name); ok {
+		return cachedResource, nil
+	}
+
 	switch resourceType {
 	case "Pod":
 		return userData.Clientset.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{})
@@ -53,7 +58,12 @@ func K8sFetchResource(sessionID, namespace, name, resourceType string) (interfac
 	case "Event":
 		return userData.Clientset.CoreV1().Events(namespace).Get(context.TODO(), name, metav1.GetOptions{})
 	default:
-		return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
+		// Any other kind (StatefulSet, DaemonSet, CRDs, ...) is resolved through discovery
+		resource, _, err := k8sclient.GetDynamicResource(userData, resourceType, namespace)
+		if err != nil {
+			return nil, err
+		}
+		return resource.Get(context.TODO(), name, metav1.GetOptions{})
 	}
 }
 
@@ -93,9 +103,13 @@ func GetResource(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Add additional fields to the metadata map
-	metadataMap["apiVersion"] = "v1" // Change this to the appropriate API version for your resource
-	metadataMap["kind"] = resourceType
+	// Add additional fields to the metadata map, dynamic resources already carry their own
+	if _, ok := metadataMap["apiVersion"]; !ok {
+		metadataMap["apiVersion"] = "v1" // Change this to the appropriate API version for your resource
+	}
+	if _, ok := metadataMap["kind"]; !ok {
+		metadataMap["kind"] = resourceType
+	}
 
 	// Encode the modified map as JSON and send it as the response
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,216 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	k8sclient "kubethor-backend/api"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// How long a debug container may take to pull its image and start
+const debugContainerStartTimeout = 2 * time.Minute
+
+var (
+	ErrContainerNotFound = errors.New("container not found")
+	ErrContainerExists   = errors.New("container already exists")
+)
+
+// DebugContainerRequest describes the ephemeral container to add to a pod.
+type DebugContainerRequest struct {
+	Image           string   `json:"image"`
+	Name            string   `json:"name,omitempty"`
+	TargetContainer string   `json:"targetContainer,omitempty"`
+	Command         []string `json:"command,omitempty"`
+}
+
+// DebugContainerResponse represents the JSON response of a created debug container.
+type DebugContainerResponse struct {
+	Namespace       string `json:"namespace"`
+	Pod             string `json:"pod"`
+	Container       string `json:"container"`
+	Image           string `json:"image"`
+	TargetContainer string `json:"targetContainer,omitempty"`
+	AttachURL       string `json:"attachUrl"`
+	Status          bool   `json:"status"`
+	Message         string `json:"message,omitempty"`
+}
+
+// K8sCreateDebugContainer adds an interactive ephemeral container to a running pod through the
+// ephemeralcontainers subresource, like kubectl debug. It returns the container as it was added.
+func K8sCreateDebugContainer(ctx context.Context, sessionID, namespace, podName string, request DebugContainerRequest) (*corev1.EphemeralContainer, error) {
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if clientset is properly initialized
+	if userData.Clientset == nil {
+		return nil, fmt.Errorf("clientset is nil, clientset not properly initialized")
+	}
+
+	if request.Image == "" {
+		return nil, fmt.Errorf("image must be provided")
+	}
+	if request.Name == "" {
+		request.Name = "debugger-" + utilrand.String(5)
+	}
+
+	debugContainer := corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:                     request.Name,
+			Image:                    request.Image,
+			Command:                  request.Command,
+			Stdin:                    true,
+			TTY:                      true,
+			TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		},
+		TargetContainerName: request.TargetContainer,
+	}
+
+	// The pod is read again when someone else updated it in between
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		pod, err := userData.Clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if err := validateDebugContainer(pod, debugContainer); err != nil {
+			return err
+		}
+
+		pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, debugContainer)
+		_, err = userData.Clientset.CoreV1().Pods(namespace).UpdateEphemeralContainers(ctx, podName, pod, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &debugContainer, nil
+}
+
+// validateDebugContainer checks the name is free and the target, if any, is a regular container of the pod
+func validateDebugContainer(pod *corev1.Pod, debugContainer corev1.EphemeralContainer) error {
+	names := make(map[string]bool)
+	for _, container := range pod.Spec.Containers {
+		names[container.Name] = true
+	}
+	if debugContainer.TargetContainerName != "" && !names[debugContainer.TargetContainerName] {
+		return fmt.Errorf("%w: target container %s in pod %s", ErrContainerNotFound, debugContainer.TargetContainerName, pod.Name)
+	}
+
+	for _, container := range pod.Spec.InitContainers {
+		names[container.Name] = true
+	}
+	for _, container := range pod.Spec.EphemeralContainers {
+		names[container.Name] = true
+	}
+	if names[debugContainer.Name] {
+		return fmt.Errorf("%w: %s in pod %s", ErrContainerExists, debugContainer.Name, pod.Name)
+	}
+
+	return nil
+}
+
+// K8sWaitForEphemeralContainer waits until the ephemeral container is running. It fails early
+// when the container terminated or its image can't be pulled.
+func K8sWaitForEphemeralContainer(ctx context.Context, sessionID, namespace, podName, containerName string) error {
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	// Check if clientset is properly initialized
+	if userData.Clientset == nil {
+		return fmt.Errorf("clientset is nil, clientset not properly initialized")
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, time.Second, debugContainerStartTimeout, true, func(ctx context.Context) (bool, error) {
+		pod, err := userData.Clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		for _, status := range pod.Status.EphemeralContainerStatuses {
+			if status.Name != containerName {
+				continue
+			}
+			switch {
+			case status.State.Running != nil:
+				return true, nil
+			case status.State.Terminated != nil:
+				return false, fmt.Errorf("container %s terminated: %s", containerName, status.State.Terminated.Reason)
+			case status.State.Waiting != nil:
+				switch status.State.Waiting.Reason {
+				case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerError":
+					return false, fmt.Errorf("container %s is not starting: %s: %s", containerName, status.State.Waiting.Reason, status.State.Waiting.Message)
+				}
+			}
+		}
+
+		// No status yet, the kubelet hasn't picked the container up
+		return false, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out waiting for container %s to start", containerName)
+	}
+	return err
+}
+
+// CreateDebugContainer adds an ephemeral debug container to a pod and returns the WebSocket path to attach to it.
+func CreateDebugContainer(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get("X-Session-Id")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	namespaceName := vars["namespace_name"]
+	podName := vars["pod_name"]
+
+	var request DebugContainerRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("failed to unmarshal JSON request: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if request.Image == "" {
+		http.Error(w, "image must be provided", http.StatusBadRequest)
+		return
+	}
+
+	debugContainer, err := K8sCreateDebugContainer(r.Context(), sessionID, namespaceName, podName, request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error creating debug container in Pod: %s: %s", podName, err.Error()), k8sErrorStatus(err))
+		return
+	}
+
+	response := DebugContainerResponse{
+		Namespace:       namespaceName,
+		Pod:             podName,
+		Container:       debugContainer.Name,
+		Image:           debugContainer.Image,
+		TargetContainer: debugContainer.TargetContainerName,
+		AttachURL:       fmt.Sprintf("/api/k8s/ws/pod-attach/%s/%s/%s", url.PathEscape(namespaceName), url.PathEscape(podName), url.PathEscape(debugContainer.Name)),
+		Status:          true,
+		Message:         fmt.Sprintf("debug container %s successfully added to Pod: %s", debugContainer.Name, podName),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding JSON response: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+}
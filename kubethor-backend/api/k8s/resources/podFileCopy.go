@@ -0,0 +1,332 @@
+package resources
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	k8sclient "kubethor-backend/api"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// Uploads larger than this are spooled to temporary files while the archive is built
+const maxUploadMemory = 32 << 20
+
+// PodFileUploadResponse represents the JSON response of an upload into a container.
+type PodFileUploadResponse struct {
+	Namespace string   `json:"namespace"`
+	Pod       string   `json:"pod"`
+	Container string   `json:"container"`
+	Path      string   `json:"path"`
+	Files     []string `json:"files"`
+	Status    bool     `json:"status"`
+	Message   string   `json:"message,omitempty"`
+}
+
+// K8sStreamPodTar archives the path inside the container with tar, like kubectl cp does, and returns the tar stream.
+// The archive entries are named after the last element of the path. An exec failure surfaces as the read error.
+func K8sStreamPodTar(ctx context.Context, sessionID, namespace, podName, containerName, srcPath string) (io.ReadCloser, error) {
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	srcPath = path.Clean(srcPath)
+	command := []string{"tar", "cf", "-", "-C", path.Dir(srcPath), path.Base(srcPath)}
+
+	reader, writer := io.Pipe()
+	go func() {
+		var stderr bytes.Buffer
+		err := k8sclient.StreamPodExec(ctx, userData, namespace, podName, containerName, command, remotecommand.StreamOptions{
+			Stdout: writer,
+			Stderr: &stderr,
+		})
+		writer.CloseWithError(execError(err, &stderr))
+	}()
+
+	return reader, nil
+}
+
+// K8sExtractPodTar extracts the tar stream into the directory inside the container.
+func K8sExtractPodTar(ctx context.Context, sessionID, namespace, podName, containerName, destDir string, archive io.Reader) error {
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	err = k8sclient.StreamPodExec(ctx, userData, namespace, podName, containerName, []string{"tar", "xmf", "-", "-C", destDir}, remotecommand.StreamOptions{
+		Stdin:  archive,
+		Stderr: &stderr,
+	})
+	return execError(err, &stderr)
+}
+
+// execError prefers what the command printed on stderr over the bare exit code
+func execError(err error, stderr *bytes.Buffer) error {
+	if err != nil && stderr.Len() > 0 {
+		return fmt.Errorf("%s", strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
+
+// DownloadPodFile downloads a file or directory from a container. A single file is returned as is,
+// a directory as a tar.gz archive. format=tar.gz always returns an archive, format=file refuses directories.
+func DownloadPodFile(w http.ResponseWriter, r *http.Request) {
+	// Browsers can't set headers on download links, so the session ID may be a query parameter too
+	sessionID := r.Header.Get("X-Session-Id")
+	if sessionID == "" {
+		sessionID = r.URL.Query().Get("sessionId")
+	}
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	namespaceName := vars["namespace_name"]
+	podName := vars["pod_name"]
+	containerName := vars["container_name"]
+	srcPath := r.URL.Query().Get("path")
+	format := r.URL.Query().Get("format")
+
+	if namespaceName == "" || podName == "" || containerName == "" || srcPath == "" {
+		http.Error(w, "namespace, pod name, container name & path must be provided", http.StatusBadRequest)
+		return
+	}
+	if format != "" && format != "file" && format != "tar.gz" {
+		http.Error(w, fmt.Sprintf("invalid format: %s, must be file or tar.gz", format), http.StatusBadRequest)
+		return
+	}
+
+	// Stop tar in the container if the client goes away
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	tarStream, err := K8sStreamPodTar(ctx, sessionID, namespaceName, podName, containerName, srcPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tarStream.Close()
+
+	tarReader := tar.NewReader(tarStream)
+	header, err := tarReader.Next()
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "No such file or directory") {
+			status = http.StatusNotFound
+		}
+		http.Error(w, fmt.Sprintf("Error copying %s from Pod: %s: %s", srcPath, podName, err.Error()), status)
+		return
+	}
+
+	isFile := header.Typeflag == tar.TypeReg
+	if format == "file" && !isFile {
+		http.Error(w, fmt.Sprintf("%s is not a regular file, use format=tar.gz", srcPath), http.StatusBadRequest)
+		return
+	}
+
+	fileName := path.Base(path.Clean(srcPath))
+	if isFile && format != "tar.gz" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+		w.Header().Set("Content-Length", strconv.FormatInt(header.Size, 10))
+		io.Copy(w, tarReader)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName+".tar.gz"))
+	gzipWriter := gzip.NewWriter(w)
+	defer gzipWriter.Close()
+	tarWriter := tar.NewWriter(gzipWriter)
+	defer tarWriter.Close()
+
+	// The first entry was already read to pick the format, re-archive it along with the rest
+	for {
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return
+		}
+		if _, err := io.Copy(tarWriter, tarReader); err != nil {
+			return
+		}
+		header, err = tarReader.Next()
+		if err != nil {
+			// Headers are sent already, a failure can only cut the archive short
+			return
+		}
+	}
+}
+
+// UploadPodFiles uploads multipart form data into a directory of a container. Every "files" part is written
+// into the directory, every "archive" part (tar or tar.gz) is extracted into it.
+func UploadPodFiles(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get("X-Session-Id")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	namespaceName := vars["namespace_name"]
+	podName := vars["pod_name"]
+	containerName := vars["container_name"]
+	destDir := r.URL.Query().Get("path")
+
+	if namespaceName == "" || podName == "" || containerName == "" || destDir == "" {
+		http.Error(w, "namespace, pod name, container name & path must be provided", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		http.Error(w, fmt.Sprintf("failed to read multipart form: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["files"]
+	archives := r.MultipartForm.File["archive"]
+	if len(files) == 0 && len(archives) == 0 {
+		http.Error(w, "at least one files or archive form field must be provided", http.StatusBadRequest)
+		return
+	}
+
+	// Build the tar stream while the container extracts it
+	reader, writer := io.Pipe()
+	uploadedCh := make(chan []string, 1)
+	go func() {
+		uploaded, err := writeUploadTar(writer, files, archives)
+		uploadedCh <- uploaded
+		writer.CloseWithError(err)
+	}()
+
+	err := K8sExtractPodTar(r.Context(), sessionID, namespaceName, podName, containerName, destDir, reader)
+	// Unblock the archive writer if the container stopped reading early
+	reader.CloseWithError(io.ErrClosedPipe)
+	uploaded := <-uploadedCh
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error copying to %s in Pod: %s: %s", destDir, podName, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	response := PodFileUploadResponse{
+		Namespace: namespaceName,
+		Pod:       podName,
+		Container: containerName,
+		Path:      destDir,
+		Files:     uploaded,
+		Status:    true,
+		Message:   fmt.Sprintf("successfully copied %d files to %s in Pod: %s", len(uploaded), destDir, podName),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding JSON response: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+}
+
+// writeUploadTar writes the uploaded archives and files as one tar stream and returns the names of the entries.
+// Entry names are kept relative to the target directory.
+func writeUploadTar(writer io.Writer, files, archives []*multipart.FileHeader) ([]string, error) {
+	tarWriter := tar.NewWriter(writer)
+	var uploaded []string
+
+	for _, archive := range archives {
+		names, err := copyUploadArchive(tarWriter, archive)
+		uploaded = append(uploaded, names...)
+		if err != nil {
+			return uploaded, fmt.Errorf("archive %s: %s", archive.Filename, err.Error())
+		}
+	}
+
+	for _, file := range files {
+		name := sanitizeTarName(file.Filename)
+		if name == "" {
+			return uploaded, fmt.Errorf("invalid file name: %s", file.Filename)
+		}
+		content, err := file.Open()
+		if err != nil {
+			return uploaded, err
+		}
+		err = tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: file.Size, Typeflag: tar.TypeReg})
+		if err == nil {
+			_, err = io.Copy(tarWriter, content)
+		}
+		content.Close()
+		if err != nil {
+			return uploaded, err
+		}
+		uploaded = append(uploaded, name)
+	}
+
+	return uploaded, tarWriter.Close()
+}
+
+// copyUploadArchive copies the entries of an uploaded tar or tar.gz archive, gzip is detected by its magic bytes
+func copyUploadArchive(tarWriter *tar.Writer, archive *multipart.FileHeader) ([]string, error) {
+	content, err := archive.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	var archiveReader io.Reader = bufio.NewReader(content)
+	if magic, err := archiveReader.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(archiveReader)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		archiveReader = gzipReader
+	}
+
+	var names []string
+	tarReader := tar.NewReader(archiveReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return names, err
+		}
+
+		// Entries may not escape the target directory
+		header.Name = sanitizeTarName(header.Name)
+		if header.Name == "" {
+			continue
+		}
+		if header.Typeflag == tar.TypeLink {
+			header.Linkname = sanitizeTarName(header.Linkname)
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return names, err
+		}
+		if _, err := io.Copy(tarWriter, tarReader); err != nil {
+			return names, err
+		}
+		names = append(names, header.Name)
+	}
+}
+
+// sanitizeTarName makes an entry name relative, without any .. element
+func sanitizeTarName(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+	if name == "." {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,156 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"io"
+	k8sclient "kubethor-backend/api"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LogOptions selects which part of a container log is read, they are the query parameters
+// of the pod logs endpoints and the log options of a stream subscription.
+type LogOptions struct {
+	Previous     bool   `json:"previous,omitempty"`
+	TailLines    *int64 `json:"tailLines,omitempty"`
+	SinceSeconds *int64 `json:"sinceSeconds,omitempty"`
+	SinceTime    string `json:"sinceTime,omitempty"`
+	Timestamps   bool   `json:"timestamps,omitempty"`
+	LimitBytes   *int64 `json:"limitBytes,omitempty"`
+}
+
+// GetLogOptions reads the previous, tailLines, sinceSeconds, sinceTime, timestamps and limitBytes query parameters,
+// e.g. ?previous=true&tailLines=100
+func GetLogOptions(r *http.Request) (LogOptions, error) {
+	query := r.URL.Query()
+	var logOptions LogOptions
+	var err error
+
+	if logOptions.Previous, err = boolQueryParam(query.Get("previous")); err != nil {
+		return LogOptions{}, fmt.Errorf("invalid previous: %s", query.Get("previous"))
+	}
+	if logOptions.Timestamps, err = boolQueryParam(query.Get("timestamps")); err != nil {
+		return LogOptions{}, fmt.Errorf("invalid timestamps: %s", query.Get("timestamps"))
+	}
+	for name, value := range map[string]**int64{
+		"tailLines":    &logOptions.TailLines,
+		"sinceSeconds": &logOptions.SinceSeconds,
+		"limitBytes":   &logOptions.LimitBytes,
+	} {
+		if param := query.Get(name); param != "" {
+			number, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				return LogOptions{}, fmt.Errorf("invalid %s: %s", name, param)
+			}
+			*value = &number
+		}
+	}
+	logOptions.SinceTime = query.Get("sinceTime")
+
+	// Validate now, so a bad parameter fails the request instead of the stream
+	if _, err := logOptions.PodLogOptions("", false); err != nil {
+		return LogOptions{}, err
+	}
+	return logOptions, nil
+}
+
+func boolQueryParam(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// PodLogOptions validates the options and converts them for a log request of the container.
+func (o LogOptions) PodLogOptions(containerName string, follow bool) (*corev1.PodLogOptions, error) {
+	logOptions := &corev1.PodLogOptions{
+		Container:  containerName,
+		Follow:     follow,
+		Previous:   o.Previous,
+		Timestamps: o.Timestamps,
+		TailLines:  o.TailLines,
+		LimitBytes: o.LimitBytes,
+	}
+
+	if o.TailLines != nil && *o.TailLines < 0 {
+		return nil, fmt.Errorf("invalid tailLines: %d, must not be negative", *o.TailLines)
+	}
+	if o.LimitBytes != nil && *o.LimitBytes <= 0 {
+		return nil, fmt.Errorf("invalid limitBytes: %d, must be positive", *o.LimitBytes)
+	}
+	if o.SinceSeconds != nil && o.SinceTime != "" {
+		return nil, fmt.Errorf("only one of sinceSeconds or sinceTime may be provided")
+	}
+	if o.SinceSeconds != nil {
+		if *o.SinceSeconds <= 0 {
+			return nil, fmt.Errorf("invalid sinceSeconds: %d, must be positive", *o.SinceSeconds)
+		}
+		logOptions.SinceSeconds = o.SinceSeconds
+	}
+	if o.SinceTime != "" {
+		sinceTime, err := time.Parse(time.RFC3339, o.SinceTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sinceTime: %s, must be an RFC3339 timestamp", o.SinceTime)
+		}
+		logOptions.SinceTime = &metav1.Time{Time: sinceTime}
+	}
+
+	return logOptions, nil
+}
+
+// K8sOpenPodLogs opens the log stream of a container with the given options.
+func K8sOpenPodLogs(ctx context.Context, userData *k8sclient.UserData, namespace, podName string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+	// Check if clientset is properly initialized
+	if userData.Clientset == nil {
+		return nil, fmt.Errorf("clientset is nil, clientset not properly initialized")
+	}
+
+	return userData.Clientset.CoreV1().Pods(namespace).GetLogs(podName, logOptions).Stream(ctx)
+}
+
+// GetPodLogs returns the logs of a container as plain text without following them.
+func GetPodLogs(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get("X-Session-Id")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	namespaceName := vars["namespace_name"]
+	podName := vars["pod_name"]
+	containerName := vars["container_name"]
+
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	options, err := GetLogOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logOptions, err := options.PodLogOptions(containerName, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	podLog, err := K8sOpenPodLogs(r.Context(), userData, namespaceName, podName, logOptions)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting logs of Pod: %s: %s", podName, err.Error()), k8sErrorStatus(err))
+		return
+	}
+	defer podLog.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.Copy(w, podLog)
+}
@@ -0,0 +1,263 @@
+package resources
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	k8sclient "kubethor-backend/api"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Pods collected at most by one archive, a larger workload must be narrowed down with a label selector
+const maxLogArchivePods = 100
+
+// logArchiveWriter adds files to a zip or tar.gz archive
+type logArchiveWriter interface {
+	WriteFile(name string, modTime time.Time, content io.Reader) error
+	Close() error
+}
+
+type zipLogArchiveWriter struct {
+	writer *zip.Writer
+}
+
+func (z *zipLogArchiveWriter) WriteFile(name string, modTime time.Time, content io.Reader) error {
+	file, err := z.writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, content)
+	return err
+}
+
+func (z *zipLogArchiveWriter) Close() error {
+	return z.writer.Close()
+}
+
+// tarLogArchiveWriter spools every file to a temporary file first, a tar header needs the size up front
+type tarLogArchiveWriter struct {
+	gzipWriter *gzip.Writer
+	tarWriter  *tar.Writer
+}
+
+func (t *tarLogArchiveWriter) WriteFile(name string, modTime time.Time, content io.Reader) error {
+	spool, err := os.CreateTemp("", "kubethor-logs-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	size, copyErr := io.Copy(spool, content)
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// Whatever was read before a failure is still worth keeping
+	if err := t.tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: modTime, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	if _, err := io.Copy(t.tarWriter, spool); err != nil {
+		return err
+	}
+	return copyErr
+}
+
+func (t *tarLogArchiveWriter) Close() error {
+	if err := t.tarWriter.Close(); err != nil {
+		return err
+	}
+	return t.gzipWriter.Close()
+}
+
+// K8sListLogArchivePods returns the pods whose logs are collected: the pod, or the pods matching the label selector.
+func K8sListLogArchivePods(ctx context.Context, userData *k8sclient.UserData, namespace, podName, labelSelector string) ([]corev1.Pod, error) {
+	// Check if clientset is properly initialized
+	if userData.Clientset == nil {
+		return nil, fmt.Errorf("clientset is nil, clientset not properly initialized")
+	}
+
+	if podName != "" {
+		pod, err := userData.Clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return []corev1.Pod{*pod}, nil
+	}
+
+	pods, err := userData.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// k8sWritePodLogsArchive adds the logs of every container of the pods to the archive, init containers and the previous
+// instance of a restarted container included. The logs that could not be read are listed in an errors.txt file.
+func k8sWritePodLogsArchive(ctx context.Context, userData *k8sclient.UserData, pods []corev1.Pod, options LogOptions, archive logArchiveWriter) error {
+	var failures []string
+	for _, pod := range pods {
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			// A container that never ran has no log, the previous instance only exists after a restart
+			var instances []bool
+			if status.State.Running != nil || status.State.Terminated != nil || status.LastTerminationState.Terminated != nil {
+				instances = append(instances, false)
+			}
+			if status.LastTerminationState.Terminated != nil {
+				instances = append(instances, true)
+			}
+
+			for _, previous := range instances {
+				name := fmt.Sprintf("%s/%s.log", pod.Name, status.Name)
+				if previous {
+					name = fmt.Sprintf("%s/%s.previous.log", pod.Name, status.Name)
+				}
+				instanceOptions := options
+				instanceOptions.Previous = previous
+				logOptions, err := instanceOptions.PodLogOptions(status.Name, false)
+				if err != nil {
+					return err
+				}
+
+				if err := writePodLogFile(ctx, userData, pod.Namespace, pod.Name, logOptions, name, archive); err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					failures = append(failures, fmt.Sprintf("%s: %s", name, err.Error()))
+				}
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return archive.WriteFile("errors.txt", time.Now(), strings.NewReader(strings.Join(failures, "\n")+"\n"))
+	}
+	return nil
+}
+
+func writePodLogFile(ctx context.Context, userData *k8sclient.UserData, namespace, podName string, logOptions *corev1.PodLogOptions, name string, archive logArchiveWriter) error {
+	podLog, err := K8sOpenPodLogs(ctx, userData, namespace, podName, logOptions)
+	if err != nil {
+		return err
+	}
+	defer podLog.Close()
+
+	return archive.WriteFile(name, time.Now(), podLog)
+}
+
+// DownloadPodLogsArchive collects the logs of a pod, a workload or the pods matching a label selector
+// into a zip or tar.gz archive.
+func DownloadPodLogsArchive(w http.ResponseWriter, r *http.Request) {
+	// Browsers can't set headers on download links, so the session ID may be a query parameter too
+	sessionID := r.Header.Get("X-Session-Id")
+	if sessionID == "" {
+		sessionID = r.URL.Query().Get("sessionId")
+	}
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	namespaceName := vars["namespace_name"]
+	query := r.URL.Query()
+	podName := query.Get("pod")
+	workload := query.Get("workload")
+	labelSelector := query.Get("labelSelector")
+	format := query.Get("format")
+
+	given := 0
+	for _, value := range []string{podName, workload, labelSelector} {
+		if value != "" {
+			given++
+		}
+	}
+	if given != 1 {
+		http.Error(w, "exactly one of pod, workload or labelSelector must be provided", http.StatusBadRequest)
+		return
+	}
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "tar.gz" {
+		http.Error(w, fmt.Sprintf("invalid format: %s, must be zip or tar.gz", format), http.StatusBadRequest)
+		return
+	}
+
+	// Optional sinceSeconds, sinceTime, tailLines, timestamps and limitBytes, applied to every log
+	options, err := GetLogOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	archiveName := podName
+	if workload != "" {
+		kind, name, err := ParseWorkload(workload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if labelSelector, err = K8sWorkloadSelector(r.Context(), userData, namespaceName, kind, name); err != nil {
+			http.Error(w, fmt.Sprintf("Error getting Workload: %s: %s", workload, err.Error()), k8sErrorStatus(err))
+			return
+		}
+		archiveName = strings.ToLower(kind) + "-" + name
+	} else if labelSelector != "" {
+		if _, err := k8sclient.NewResourceSelector(labelSelector, ""); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		archiveName = "pods"
+	}
+
+	pods, err := K8sListLogArchivePods(r.Context(), userData, namespaceName, podName, labelSelector)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing Pods: %s", err.Error()), k8sErrorStatus(err))
+		return
+	}
+	if len(pods) == 0 {
+		http.Error(w, "no Pods found", http.StatusNotFound)
+		return
+	}
+	if len(pods) > maxLogArchivePods {
+		http.Error(w, fmt.Sprintf("%d Pods found, at most %d can be collected, narrow the selector", len(pods), maxLogArchivePods), http.StatusBadRequest)
+		return
+	}
+
+	fileName := fmt.Sprintf("%s-%s-logs-%s.%s", namespaceName, archiveName, time.Now().UTC().Format("20060102T150405Z"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+
+	var archive logArchiveWriter
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+		archive = &zipLogArchiveWriter{writer: zip.NewWriter(w)}
+	} else {
+		w.Header().Set("Content-Type", "application/gzip")
+		gzipWriter := gzip.NewWriter(w)
+		archive = &tarLogArchiveWriter{gzipWriter: gzipWriter, tarWriter: tar.NewWriter(gzipWriter)}
+	}
+
+	// Headers are sent with the first file, a failure afterwards can only cut the archive short
+	if err := k8sWritePodLogsArchive(r.Context(), userData, pods, options, archive); err != nil {
+		return
+	}
+	archive.Close()
+}
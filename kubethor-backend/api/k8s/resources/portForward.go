@@ -0,0 +1,348 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	k8sclient "kubethor-backend/api"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Cookie carrying the session ID of the proxied pages, browsers can't set the X-Session-Id header on navigation
+const portForwardSessionCookie = "kubethor-port-forward-session"
+
+// Sandbox of the proxied pages, scripts and forms work but allow-same-origin is left out on purpose
+const portForwardSandboxPolicy = "sandbox allow-scripts allow-forms allow-popups allow-modals allow-downloads"
+
+// PortForwardResponse represents the JSON response of stopping a port-forward.
+type PortForwardResponse struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Port      int    `json:"port"`
+	Status    bool   `json:"status"`
+	Message   string `json:"message,omitempty"`
+}
+
+// K8sPortForward returns the session's port-forward to the pod port, starting it on first use.
+func K8sPortForward(sessionID, namespace, podName string, port int) (*k8sclient.PortForward, error) {
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if clientset is properly initialized
+	if userData.Clientset == nil || userData.PortForwards == nil {
+		return nil, fmt.Errorf("clientset is nil, clientset not properly initialized")
+	}
+
+	return userData.PortForwards.PortForward(namespace, podName, port)
+}
+
+// K8sResolveServicePort resolves a service port to a ready pod behind the service and the container port it targets,
+// like kubectl port-forward svc/{service_name} does.
+func K8sResolveServicePort(sessionID, namespace, serviceName string, port int) (string, int, error) {
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Check if clientset is properly initialized
+	if userData.Clientset == nil {
+		return "", 0, fmt.Errorf("clientset is nil, clientset not properly initialized")
+	}
+
+	service, err := userData.Clientset.CoreV1().Services(namespace).Get(context.TODO(), serviceName, metav1.GetOptions{})
+	if err != nil {
+		return "", 0, err
+	}
+
+	var servicePort *corev1.ServicePort
+	for i := range service.Spec.Ports {
+		if int(service.Spec.Ports[i].Port) == port {
+			servicePort = &service.Spec.Ports[i]
+			break
+		}
+	}
+	if servicePort == nil {
+		return "", 0, fmt.Errorf("service %s does not expose port %d", serviceName, port)
+	}
+	if len(service.Spec.Selector) == 0 {
+		return "", 0, fmt.Errorf("service %s has no selector, its pods can't be resolved", serviceName)
+	}
+
+	pods, err := userData.Clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(service.Spec.Selector).String(),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	sort.Slice(pods.Items, func(i, j int) bool { return pods.Items[i].Name < pods.Items[j].Name })
+
+	for _, pod := range pods.Items {
+		if !isPodReady(&pod) {
+			continue
+		}
+		podPort, err := resolveTargetPort(&pod, servicePort)
+		if err != nil {
+			return "", 0, err
+		}
+		return pod.Name, podPort, nil
+	}
+
+	return "", 0, fmt.Errorf("no ready pod found for service %s", serviceName)
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// resolveTargetPort returns the container port a service port targets in the pod, named target ports included
+func resolveTargetPort(pod *corev1.Pod, servicePort *corev1.ServicePort) (int, error) {
+	switch servicePort.TargetPort.Type {
+	case intstr.String:
+		for _, container := range pod.Spec.Containers {
+			for _, containerPort := range container.Ports {
+				if containerPort.Name == servicePort.TargetPort.StrVal {
+					return int(containerPort.ContainerPort), nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("pod %s has no container port named %s", pod.Name, servicePort.TargetPort.StrVal)
+	default:
+		if servicePort.TargetPort.IntVal == 0 {
+			return int(servicePort.Port), nil
+		}
+		return int(servicePort.TargetPort.IntVal), nil
+	}
+}
+
+// portForwardSessionID reads the session ID from the X-Session-Id header, the sessionId query parameter or the
+// session cookie. A session ID passed as query parameter is kept in a cookie scoped to the proxied pages.
+func portForwardSessionID(w http.ResponseWriter, r *http.Request, prefix string) string {
+	if sessionID := r.Header.Get("X-Session-Id"); sessionID != "" {
+		return sessionID
+	}
+	if sessionID := r.URL.Query().Get("sessionId"); sessionID != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     portForwardSessionCookie,
+			Value:    sessionID,
+			Path:     prefix,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return sessionID
+	}
+	if cookie, err := r.Cookie(portForwardSessionCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// servePortForwardProxy proxies the request to the port-forward, rooted at prefix. WebSocket upgrades are proxied too.
+func servePortForwardProxy(w http.ResponseWriter, r *http.Request, forward *k8sclient.PortForward, prefix, path string) {
+	target := &url.URL{Scheme: "http", Host: forward.LocalAddress()}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(proxyRequest *httputil.ProxyRequest) {
+			proxyRequest.SetURL(target)
+			proxyRequest.Out.URL.Path = "/" + path
+			proxyRequest.Out.URL.RawPath = ""
+			proxyRequest.SetXForwarded()
+			proxyRequest.Out.Header.Set("X-Forwarded-Prefix", strings.TrimSuffix(prefix, "/"))
+
+			// Never leak the Kubethor session to the proxied application
+			query := proxyRequest.Out.URL.Query()
+			query.Del("sessionId")
+			proxyRequest.Out.URL.RawQuery = query.Encode()
+			proxyRequest.Out.Header.Del("X-Session-Id")
+			cookies := proxyRequest.Out.Cookies()
+			proxyRequest.Out.Header.Del("Cookie")
+			for _, cookie := range cookies {
+				if cookie.Name != portForwardSessionCookie {
+					proxyRequest.Out.AddCookie(cookie)
+				}
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			// Keep absolute redirects of the application under the proxy prefix
+			location := resp.Header.Get("Location")
+			if strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "//") && !strings.HasPrefix(location, prefix) {
+				resp.Header.Set("Location", prefix+strings.TrimPrefix(location, "/"))
+			}
+
+			// The application is served from the Kubethor origin, so its pages run sandboxed in an opaque origin
+			// and can neither read the Kubethor session nor call the API with it, nor set cookies on the origin
+			resp.Header.Add("Content-Security-Policy", portForwardSandboxPolicy)
+			resp.Header.Del("Set-Cookie")
+			resp.Header.Del("X-Session-Id")
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, fmt.Sprintf("Error proxying to Pod: %s port %d: %s", forward.Pod, forward.Port, err.Error()), http.StatusBadGateway)
+		},
+	}
+
+	proxy.ServeHTTP(w, r)
+}
+
+// PortForwardProxy exposes a pod port as an HTTP reverse proxy under /port-forward/{namespace_name}/{pod_name}/{port}/.
+func PortForwardProxy(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	namespaceName := vars["namespace_name"]
+	podName := vars["pod_name"]
+	path := vars["path"]
+	prefix := strings.TrimSuffix(r.URL.Path, path)
+
+	sessionID := portForwardSessionID(w, r, prefix)
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	port, err := strconv.Atoi(vars["port"])
+	if err != nil || namespaceName == "" || podName == "" {
+		http.Error(w, "namespace, pod name & port must be provided", http.StatusBadRequest)
+		return
+	}
+
+	forward, err := K8sPortForward(sessionID, namespaceName, podName, port)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error forwarding Pod: %s port %d: %s", podName, port, err.Error()), http.StatusBadGateway)
+		return
+	}
+
+	servePortForwardProxy(w, r, forward, prefix, path)
+}
+
+// ServicePortForwardProxy exposes a service port as an HTTP reverse proxy under /port-forward-service/{namespace_name}/{service_name}/{port}/,
+// forwarding to a ready pod behind the service.
+func ServicePortForwardProxy(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	namespaceName := vars["namespace_name"]
+	serviceName := vars["service_name"]
+	path := vars["path"]
+	prefix := strings.TrimSuffix(r.URL.Path, path)
+
+	sessionID := portForwardSessionID(w, r, prefix)
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	port, err := strconv.Atoi(vars["port"])
+	if err != nil || namespaceName == "" || serviceName == "" {
+		http.Error(w, "namespace, service name & port must be provided", http.StatusBadRequest)
+		return
+	}
+
+	podName, podPort, err := K8sResolveServicePort(sessionID, namespaceName, serviceName, port)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving Service: %s port %d: %s", serviceName, port, err.Error()), http.StatusBadGateway)
+		return
+	}
+
+	forward, err := K8sPortForward(sessionID, namespaceName, podName, podPort)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error forwarding Pod: %s port %d: %s", podName, podPort, err.Error()), http.StatusBadGateway)
+		return
+	}
+
+	servePortForwardProxy(w, r, forward, prefix, path)
+}
+
+// PortForwardRedirect adds the trailing slash to the proxy root, so relative links of the application resolve under it.
+func PortForwardRedirect(w http.ResponseWriter, r *http.Request) {
+	redirectURL := *r.URL
+	redirectURL.Path += "/"
+	http.Redirect(w, r, redirectURL.String(), http.StatusMovedPermanently)
+}
+
+// ListPortForwards returns the active port-forwards of the session.
+func ListPortForwards(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get("X-Session-Id")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if userData.PortForwards == nil {
+		http.Error(w, "clientset is nil, clientset not properly initialized", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(userData.PortForwards.List()); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding JSON response: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+}
+
+// StopPortForward stops the session's port-forward to the pod port.
+func StopPortForward(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get("X-Session-Id")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	namespaceName := vars["namespace_name"]
+	podName := vars["pod_name"]
+	port, err := strconv.Atoi(vars["port"])
+	if err != nil || namespaceName == "" || podName == "" {
+		http.Error(w, "namespace, pod name & port must be provided", http.StatusBadRequest)
+		return
+	}
+
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if userData.PortForwards == nil {
+		http.Error(w, "clientset is nil, clientset not properly initialized", http.StatusInternalServerError)
+		return
+	}
+
+	if !userData.PortForwards.StopPortForward(namespaceName, podName, port) {
+		http.Error(w, fmt.Sprintf("no active port-forward to Pod: %s port %d in %s", podName, port, namespaceName), http.StatusNotFound)
+		return
+	}
+
+	response := PortForwardResponse{
+		Namespace: namespaceName,
+		Pod:       podName,
+		Port:      port,
+		Status:    true,
+		Message:   fmt.Sprintf("successfully stopped port-forward to Pod: %s port %d in %s", podName, port, namespaceName),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding JSON response: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+}
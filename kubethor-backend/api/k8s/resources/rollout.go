@@ -0,0 +1,540 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	k8sclient "kubethor-backend/api"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Annotations kubectl uses for rollouts
+const (
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+	changeCauseAnnotation = "kubernetes.io/change-cause"
+	revisionAnnotation    = "deployment.kubernetes.io/revision"
+)
+
+// RolloutResponse represents the JSON response of a rollout action.
+type RolloutResponse struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Action    string `json:"action"`
+	Revision  int64  `json:"revision,omitempty"`
+	Status    bool   `json:"status"`
+	Message   string `json:"message,omitempty"`
+}
+
+// RolloutRevision is a revision of a rollout, read from a ReplicaSet of a Deployment
+// or a ControllerRevision of a StatefulSet or DaemonSet.
+type RolloutRevision struct {
+	Revision    int64     `json:"revision"`
+	Name        string    `json:"name"`
+	ChangeCause string    `json:"changeCause,omitempty"`
+	Images      []string  `json:"images"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Current     bool      `json:"current"`
+	template    *corev1.PodTemplateSpec
+	patch       []byte
+}
+
+// RolloutHistoryResponse represents the JSON response of a rollout history, oldest revision first.
+type RolloutHistoryResponse struct {
+	Namespace string            `json:"namespace"`
+	Kind      string            `json:"kind"`
+	Name      string            `json:"name"`
+	Revisions []RolloutRevision `json:"revisions"`
+}
+
+// RolloutKind resolves a resource type into one of the kinds with rollouts: Deployment, StatefulSet or DaemonSet.
+func RolloutKind(resourceType string) (string, error) {
+	kind := workloadKinds[strings.ToLower(resourceType)]
+	if kind != "Deployment" && kind != "StatefulSet" && kind != "DaemonSet" {
+		return "", apierrors.NewBadRequest(fmt.Sprintf("unsupported resource type: %s, rollouts are supported for Deployment, StatefulSet and DaemonSet", resourceType))
+	}
+	return kind, nil
+}
+
+// K8sRolloutRestart restarts the pods of the workload by setting the restartedAt annotation on its pod template, like kubectl rollout restart.
+func K8sRolloutRestart(ctx context.Context, sessionID, namespace, kind, name string) (*RolloutResponse, error) {
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if clientset is properly initialized
+	if userData.Clientset == nil {
+		return nil, fmt.Errorf("clientset is nil, clientset not properly initialized")
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{restartedAtAnnotation: time.Now().Format(time.RFC3339)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	apps := userData.Clientset.AppsV1()
+	switch kind {
+	case "Deployment":
+		deployment, err := apps.Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if deployment.Spec.Paused {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("can't restart paused Deployment %s, resume it first", name))
+		}
+		_, err = apps.Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return nil, err
+		}
+	case "StatefulSet":
+		if _, err := apps.StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return nil, err
+		}
+	case "DaemonSet":
+		if _, err := apps.DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &RolloutResponse{
+		Namespace: namespace,
+		Kind:      kind,
+		Name:      name,
+		Action:    "restart",
+		Status:    true,
+		Message:   fmt.Sprintf("%s %s successfully restarted", kind, name),
+	}, nil
+}
+
+// K8sRolloutPause pauses or resumes the rollout of a Deployment, the only kind that can be paused.
+func K8sRolloutPause(ctx context.Context, sessionID, namespace, kind, name string, paused bool) (*RolloutResponse, error) {
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if clientset is properly initialized
+	if userData.Clientset == nil {
+		return nil, fmt.Errorf("clientset is nil, clientset not properly initialized")
+	}
+
+	action := "pause"
+	if !paused {
+		action = "resume"
+	}
+	if kind != "Deployment" {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("%s is not supported for %s, only Deployments can be paused", action, kind))
+	}
+
+	deployments := userData.Clientset.AppsV1().Deployments(namespace)
+	deployment, err := deployments.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	response := &RolloutResponse{Namespace: namespace, Kind: kind, Name: name, Action: action, Status: true}
+	if deployment.Spec.Paused == paused {
+		response.Message = fmt.Sprintf("%s %s is already %sd", kind, name, action)
+		return response, nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"paused": paused}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := deployments.Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return nil, err
+	}
+
+	response.Message = fmt.Sprintf("%s %s successfully %sd", kind, name, action)
+	return response, nil
+}
+
+// K8sRolloutHistory lists the revisions of the workload, oldest first.
+func K8sRolloutHistory(ctx context.Context, sessionID, namespace, kind, name string) ([]RolloutRevision, error) {
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, revisions, err := k8sRolloutHistory(ctx, userData, namespace, kind, name)
+	return revisions, err
+}
+
+// k8sRolloutHistory lists the revisions of the workload, oldest first. For a Deployment it also returns
+// the Deployment the revisions were read from.
+func k8sRolloutHistory(ctx context.Context, userData *k8sclient.UserData, namespace, kind, name string) (*appsv1.Deployment, []RolloutRevision, error) {
+	// Check if clientset is properly initialized
+	if userData.Clientset == nil {
+		return nil, nil, fmt.Errorf("clientset is nil, clientset not properly initialized")
+	}
+
+	var deployment *appsv1.Deployment
+	var revisions []RolloutRevision
+	var err error
+	if kind == "Deployment" {
+		deployment, revisions, err = k8sDeploymentRevisions(ctx, userData, namespace, name)
+	} else {
+		revisions, err = k8sControllerRevisions(ctx, userData, namespace, kind, name)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+	return deployment, revisions, nil
+}
+
+// k8sDeploymentRevisions reads the revisions from the ReplicaSets the Deployment owns, along with the Deployment
+func k8sDeploymentRevisions(ctx context.Context, userData *k8sclient.UserData, namespace, name string) (*appsv1.Deployment, []RolloutRevision, error) {
+	deployment, err := userData.Clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	replicaSets, err := userData.Clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	currentRevision := deployment.Annotations[revisionAnnotation]
+	var revisions []RolloutRevision
+	for i := range replicaSets.Items {
+		replicaSet := &replicaSets.Items[i]
+		if !metav1.IsControlledBy(replicaSet, deployment) {
+			continue
+		}
+		revision, err := strconv.ParseInt(replicaSet.Annotations[revisionAnnotation], 10, 64)
+		if err != nil {
+			continue
+		}
+		revisions = append(revisions, RolloutRevision{
+			Revision:    revision,
+			Name:        replicaSet.Name,
+			ChangeCause: replicaSet.Annotations[changeCauseAnnotation],
+			Images:      templateImages(&replicaSet.Spec.Template),
+			CreatedAt:   replicaSet.CreationTimestamp.Time,
+			Current:     replicaSet.Annotations[revisionAnnotation] == currentRevision,
+			template:    &replicaSet.Spec.Template,
+		})
+	}
+	return deployment, revisions, nil
+}
+
+// k8sControllerRevisions reads the revisions from the ControllerRevisions the StatefulSet or DaemonSet owns
+func k8sControllerRevisions(ctx context.Context, userData *k8sclient.UserData, namespace, kind, name string) ([]RolloutRevision, error) {
+	apps := userData.Clientset.AppsV1()
+
+	var owner metav1.Object
+	var labelSelector *metav1.LabelSelector
+	currentName := ""
+	switch kind {
+	case "StatefulSet":
+		statefulSet, err := apps.StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		owner, labelSelector, currentName = statefulSet, statefulSet.Spec.Selector, statefulSet.Status.UpdateRevision
+	case "DaemonSet":
+		daemonSet, err := apps.DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		owner, labelSelector = daemonSet, daemonSet.Spec.Selector
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return nil, err
+	}
+	controllerRevisions, err := apps.ControllerRevisions(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []RolloutRevision
+	var latest *RolloutRevision
+	for i := range controllerRevisions.Items {
+		controllerRevision := &controllerRevisions.Items[i]
+		if !metav1.IsControlledBy(controllerRevision, owner) {
+			continue
+		}
+		revisions = append(revisions, RolloutRevision{
+			Revision:    controllerRevision.Revision,
+			Name:        controllerRevision.Name,
+			ChangeCause: controllerRevision.Annotations[changeCauseAnnotation],
+			Images:      controllerRevisionImages(controllerRevision),
+			CreatedAt:   controllerRevision.CreationTimestamp.Time,
+			Current:     controllerRevision.Name == currentName,
+			patch:       controllerRevision.Data.Raw,
+		})
+	}
+
+	// A DaemonSet doesn't report its revision, the latest one is current like kubectl assumes
+	if currentName == "" {
+		for i := range revisions {
+			if latest == nil || revisions[i].Revision > latest.Revision {
+				latest = &revisions[i]
+			}
+		}
+		if latest != nil {
+			latest.Current = true
+		}
+	}
+	return revisions, nil
+}
+
+func templateImages(template *corev1.PodTemplateSpec) []string {
+	images := []string{}
+	for _, container := range template.Spec.Containers {
+		images = append(images, container.Image)
+	}
+	return images
+}
+
+// controllerRevisionImages reads the images from the pod template patch a ControllerRevision stores
+func controllerRevisionImages(controllerRevision *appsv1.ControllerRevision) []string {
+	var data struct {
+		Spec struct {
+			Template corev1.PodTemplateSpec `json:"template"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(controllerRevision.Data.Raw, &data); err != nil {
+		return []string{}
+	}
+	return templateImages(&data.Spec.Template)
+}
+
+// K8sRolloutUndo rolls the workload back to the revision, or to the one before the current revision when it is 0.
+func K8sRolloutUndo(ctx context.Context, sessionID, namespace, kind, name string, toRevision int64) (*RolloutResponse, error) {
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The history of a Deployment and the resourceVersion its rollback is conditional on come from the same read
+	deployment, revisions, err := k8sRolloutHistory(ctx, userData, namespace, kind, name)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := undoTargetRevision(revisions, toRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &RolloutResponse{Namespace: namespace, Kind: kind, Name: name, Action: "undo", Revision: target.Revision, Status: true}
+	if target.Current {
+		response.Message = fmt.Sprintf("%s %s is already at revision %d", kind, name, target.Revision)
+		return response, nil
+	}
+
+	apps := userData.Clientset.AppsV1()
+	switch kind {
+	case "Deployment":
+		if deployment.Spec.Paused {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("can't roll back paused Deployment %s, resume it first", name))
+		}
+
+		// The ReplicaSet template carries the hash label its controller added, the Deployment template doesn't
+		template := target.template.DeepCopy()
+		delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+
+		patchOperations := []map[string]interface{}{
+			{"op": "test", "path": "/metadata/resourceVersion", "value": deployment.ResourceVersion},
+			{"op": "replace", "path": "/spec/template", "value": template},
+		}
+		if target.ChangeCause != "" {
+			patchOperations = append(patchOperations, map[string]interface{}{
+				"op": "add", "path": "/metadata/annotations", "value": withAnnotation(deployment.Annotations, changeCauseAnnotation, target.ChangeCause),
+			})
+		}
+		patch, err := json.Marshal(patchOperations)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := apps.Deployments(namespace).Patch(ctx, name, types.JSONPatchType, patch, metav1.PatchOptions{}); err != nil {
+			return nil, err
+		}
+	case "StatefulSet":
+		// A ControllerRevision stores the template as a strategic merge patch, like kubectl applies it
+		if _, err := apps.StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, target.patch, metav1.PatchOptions{}); err != nil {
+			return nil, err
+		}
+	case "DaemonSet":
+		if _, err := apps.DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, target.patch, metav1.PatchOptions{}); err != nil {
+			return nil, err
+		}
+	}
+
+	response.Message = fmt.Sprintf("%s %s successfully rolled back to revision %d", kind, name, target.Revision)
+	return response, nil
+}
+
+// undoTargetRevision picks the revision to roll back to from the history, oldest first
+func undoTargetRevision(revisions []RolloutRevision, toRevision int64) (*RolloutRevision, error) {
+	if toRevision == 0 {
+		// The latest revision that isn't the current one
+		for i := len(revisions) - 1; i >= 0; i-- {
+			if !revisions[i].Current {
+				return &revisions[i], nil
+			}
+		}
+		return nil, apierrors.NewBadRequest("no previous revision to roll back to")
+	}
+
+	for i := range revisions {
+		if revisions[i].Revision == toRevision {
+			return &revisions[i], nil
+		}
+	}
+	return nil, apierrors.NewNotFound(appsv1.Resource("revision"), strconv.FormatInt(toRevision, 10))
+}
+
+func withAnnotation(annotations map[string]string, key, value string) map[string]string {
+	updated := make(map[string]string, len(annotations)+1)
+	for k, v := range annotations {
+		updated[k] = v
+	}
+	updated[key] = value
+	return updated
+}
+
+// rolloutTarget reads the session and the workload of a rollout request, it writes the error response itself
+func rolloutTarget(w http.ResponseWriter, r *http.Request) (string, string, string, string, bool) {
+	sessionID := r.Header.Get("X-Session-Id")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return "", "", "", "", false
+	}
+
+	vars := mux.Vars(r)
+	kind, err := RolloutKind(vars["resource_type"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", "", "", "", false
+	}
+
+	return sessionID, kind, vars["namespace_name"], vars["resource_name"], true
+}
+
+func writeRolloutResponse(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding JSON response: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+}
+
+// RolloutRestart restarts the pods of a Deployment, StatefulSet or DaemonSet.
+func RolloutRestart(w http.ResponseWriter, r *http.Request) {
+	sessionID, kind, namespaceName, resourceName, ok := rolloutTarget(w, r)
+	if !ok {
+		return
+	}
+
+	response, err := K8sRolloutRestart(r.Context(), sessionID, namespaceName, kind, resourceName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error restarting %s: %s: %s", kind, resourceName, err.Error()), k8sErrorStatus(err))
+		return
+	}
+	writeRolloutResponse(w, response)
+}
+
+// RolloutPause pauses the rollout of a Deployment.
+func RolloutPause(w http.ResponseWriter, r *http.Request) {
+	rolloutPause(w, r, true)
+}
+
+// RolloutResume resumes the rollout of a paused Deployment.
+func RolloutResume(w http.ResponseWriter, r *http.Request) {
+	rolloutPause(w, r, false)
+}
+
+func rolloutPause(w http.ResponseWriter, r *http.Request, paused bool) {
+	sessionID, kind, namespaceName, resourceName, ok := rolloutTarget(w, r)
+	if !ok {
+		return
+	}
+
+	response, err := K8sRolloutPause(r.Context(), sessionID, namespaceName, kind, resourceName, paused)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error updating rollout of %s: %s: %s", kind, resourceName, err.Error()), k8sErrorStatus(err))
+		return
+	}
+	writeRolloutResponse(w, response)
+}
+
+// RolloutHistory lists the revisions of a Deployment, StatefulSet or DaemonSet.
+func RolloutHistory(w http.ResponseWriter, r *http.Request) {
+	sessionID, kind, namespaceName, resourceName, ok := rolloutTarget(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := K8sRolloutHistory(r.Context(), sessionID, namespaceName, kind, resourceName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting rollout history of %s: %s: %s", kind, resourceName, err.Error()), k8sErrorStatus(err))
+		return
+	}
+	if revisions == nil {
+		revisions = []RolloutRevision{}
+	}
+	writeRolloutResponse(w, RolloutHistoryResponse{Namespace: namespaceName, Kind: kind, Name: resourceName, Revisions: revisions})
+}
+
+// RolloutUndo rolls a Deployment, StatefulSet or DaemonSet back to a revision, the previous one by default.
+func RolloutUndo(w http.ResponseWriter, r *http.Request) {
+	sessionID, kind, namespaceName, resourceName, ok := rolloutTarget(w, r)
+	if !ok {
+		return
+	}
+
+	// Optional body with the revision, e.g. {"revision": 3}
+	var request struct {
+		Revision int64 `json:"revision"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, fmt.Sprintf("failed to unmarshal JSON request: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+	}
+	if request.Revision < 0 {
+		http.Error(w, "revision must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	response, err := K8sRolloutUndo(r.Context(), sessionID, namespaceName, kind, resourceName, request.Revision)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error rolling back %s: %s: %s", kind, resourceName, err.Error()), k8sErrorStatus(err))
+		return
+	}
+	writeRolloutResponse(w, response)
+}
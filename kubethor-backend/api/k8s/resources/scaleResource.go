@@ -0,0 +1,151 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	k8sclient "kubethor-backend/api"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ScaleRequest is the body of a scale request.
+type ScaleRequest struct {
+	Replicas *int32 `json:"replicas"`
+}
+
+// ScaleResponse represents the JSON response of a scaled resource. Replicas is the desired count,
+// CurrentReplicas the count the controller reported when the request was applied.
+type ScaleResponse struct {
+	Namespace       string   `json:"namespace"`
+	Kind            string   `json:"kind"`
+	Name            string   `json:"name"`
+	Replicas        int64    `json:"replicas"`
+	CurrentReplicas int64    `json:"currentReplicas"`
+	Selector        string   `json:"selector,omitempty"`
+	Warnings        []string `json:"warnings,omitempty"`
+	Status          bool     `json:"status"`
+	Message         string   `json:"message,omitempty"`
+}
+
+// K8sScaleResource sets the replica count through the scale subresource, so only the replicas are changed,
+// for any kind that has one: Deployments, StatefulSets, ReplicaSets, ReplicationControllers and custom resources.
+func K8sScaleResource(ctx context.Context, sessionID, namespace, resourceType, name string, replicas int32) (*ScaleResponse, error) {
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	resource, mapping, err := k8sclient.GetDynamicResource(userData, resourceType, namespace)
+	if err != nil {
+		return nil, err
+	}
+	kind := mapping.GroupVersionKind.Kind
+
+	// Tell a missing resource apart from a kind without a scale subresource
+	if _, err := resource.Get(ctx, name, metav1.GetOptions{}); err != nil {
+		return nil, err
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"replicas": replicas}})
+	if err != nil {
+		return nil, err
+	}
+	scale, err := resource.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}, "scale")
+	if apierrors.IsNotFound(err) {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("%s %s is not scalable", kind, name))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ScaleResponse{
+		Namespace: namespace,
+		Kind:      kind,
+		Name:      name,
+		Status:    true,
+		Message:   fmt.Sprintf("%s %s successfully scaled to %d replicas", kind, name, replicas),
+	}
+	response.Replicas, _, _ = unstructured.NestedInt64(scale.Object, "spec", "replicas")
+	response.CurrentReplicas, _, _ = unstructured.NestedInt64(scale.Object, "status", "replicas")
+	response.Selector, _, _ = unstructured.NestedString(scale.Object, "status", "selector")
+	response.Warnings = k8sAutoscalerWarnings(ctx, userData, namespace, mapping.GroupVersionKind, name)
+
+	return response, nil
+}
+
+// k8sAutoscalerWarnings warns about the HorizontalPodAutoscalers targeting the resource, they override a manual scale.
+// It is best effort, a user that can't list them gets no warning. The target must match the group too,
+// any API version of it scales the same resource.
+func k8sAutoscalerWarnings(ctx context.Context, userData *k8sclient.UserData, namespace string, gvk schema.GroupVersionKind, name string) []string {
+	if userData.Clientset == nil {
+		return nil
+	}
+
+	autoscalers, err := userData.Clientset.AutoscalingV1().HorizontalPodAutoscalers(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil
+	}
+
+	var warnings []string
+	for _, autoscaler := range autoscalers.Items {
+		target := autoscaler.Spec.ScaleTargetRef
+		if target.Kind != gvk.Kind || target.Name != name {
+			continue
+		}
+		if targetGroupVersion, err := schema.ParseGroupVersion(target.APIVersion); err != nil || targetGroupVersion.Group != gvk.Group {
+			continue
+		}
+		minReplicas := int32(1)
+		if autoscaler.Spec.MinReplicas != nil {
+			minReplicas = *autoscaler.Spec.MinReplicas
+		}
+		warnings = append(warnings, fmt.Sprintf("HorizontalPodAutoscaler %s manages %s %s between %d and %d replicas and may override the replica count",
+			autoscaler.Name, gvk.Kind, name, minReplicas, autoscaler.Spec.MaxReplicas))
+	}
+	return warnings
+}
+
+// ScaleResource changes the replica count of a resource.
+func ScaleResource(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get("X-Session-Id")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	resourceType := vars["resource_type"]
+	namespaceName := vars["namespace_name"]
+	resourceName := vars["resource_name"]
+
+	var request ScaleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("failed to unmarshal JSON request: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if request.Replicas == nil || *request.Replicas < 0 {
+		http.Error(w, "replicas must be provided and must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	response, err := K8sScaleResource(r.Context(), sessionID, namespaceName, resourceType, resourceName, *request.Replicas)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error scaling %s: %s: %s", resourceType, resourceName, err.Error()), k8sErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding JSON response: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,213 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	k8sclient "kubethor-backend/api"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// podSpecPaths is where the pod spec of every kind with editable containers lives
+var podSpecPaths = map[string][]string{
+	"Pod":         {"spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// SetImageRequest is the body of an image set request, the new image of every container by name.
+type SetImageRequest struct {
+	Containers map[string]string `json:"containers"`
+}
+
+// ContainerImage is a container whose image was set. Type is container or initContainer.
+type ContainerImage struct {
+	Container     string `json:"container"`
+	Type          string `json:"type"`
+	Image         string `json:"image"`
+	PreviousImage string `json:"previousImage"`
+}
+
+// SetImageResponse represents the JSON response of an image set.
+type SetImageResponse struct {
+	Namespace  string           `json:"namespace"`
+	Kind       string           `json:"kind"`
+	Name       string           `json:"name"`
+	Containers []ContainerImage `json:"containers"`
+	Status     bool             `json:"status"`
+	Message    string           `json:"message,omitempty"`
+}
+
+// podSpecContainerFields are the container lists of a pod spec
+var podSpecContainerFields = []string{"containers", "initContainers", "ephemeralContainers"}
+
+// k8sGetPodSpecResource gets a resource with a pod spec through the dynamic client, along with its kind and the path of its pod spec.
+func k8sGetPodSpecResource(ctx context.Context, sessionID, namespace, resourceType, name string) (dynamic.ResourceInterface, *unstructured.Unstructured, string, []string, error) {
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+
+	resource, mapping, err := k8sclient.GetDynamicResource(userData, resourceType, namespace)
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+	kind := mapping.GroupVersionKind.Kind
+	group := mapping.GroupVersionKind.Group
+	podSpecPath, ok := podSpecPaths[kind]
+	if !ok || (group != "" && group != "apps" && group != "batch") {
+		return nil, nil, "", nil, apierrors.NewBadRequest(fmt.Sprintf("unsupported resource type: %s, containers can be changed for Deployment, StatefulSet, DaemonSet, Job, CronJob and Pod", resourceType))
+	}
+
+	object, err := resource.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+	return resource, object, kind, podSpecPath, nil
+}
+
+// findPodSpecContainer finds a container or init container by name, it returns the list it is in.
+// A container that doesn't exist fails with ErrContainerNotFound.
+func findPodSpecContainer(object *unstructured.Unstructured, kind string, podSpecPath []string, containerName string) (string, map[string]interface{}, error) {
+	for _, field := range podSpecContainerFields {
+		containers, _, _ := unstructured.NestedSlice(object.Object, append(append([]string{}, podSpecPath...), field)...)
+		for _, item := range containers {
+			container, ok := item.(map[string]interface{})
+			if !ok || container["name"] != containerName {
+				continue
+			}
+			// The API only lets ephemeral containers be added, never changed
+			if field == "ephemeralContainers" {
+				return "", nil, apierrors.NewBadRequest(fmt.Sprintf("ephemeral container %s in %s %s can't be changed, add a new debug container instead", containerName, kind, object.GetName()))
+			}
+			return field, container, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%w: %s in %s %s", ErrContainerNotFound, containerName, kind, object.GetName())
+}
+
+// podSpecPatch nests the container lists under the pod spec path into a strategic merge patch,
+// the lists are merged by container name. The resourceVersion the containers were checked at makes the patch
+// fail with a conflict if the resource changed since, instead of re-adding a container removed meanwhile.
+func podSpecPatch(podSpecPath []string, resourceVersion string, lists map[string][]interface{}) ([]byte, error) {
+	var patchObject interface{} = lists
+	for i := len(podSpecPath) - 1; i >= 0; i-- {
+		patchObject = map[string]interface{}{podSpecPath[i]: patchObject}
+	}
+	if resourceVersion != "" {
+		patchObject.(map[string]interface{})["metadata"] = map[string]interface{}{"resourceVersion": resourceVersion}
+	}
+	return json.Marshal(patchObject)
+}
+
+// K8sSetImage sets the images of containers and init containers, like kubectl set image, with one strategic merge patch
+// so nothing else of the resource is touched. A container name that doesn't exist fails with ErrContainerNotFound
+// before anything is changed.
+func K8sSetImage(ctx context.Context, sessionID, namespace, resourceType, name string, images map[string]string) (*SetImageResponse, error) {
+	resource, object, kind, podSpecPath, err := k8sGetPodSpecResource(ctx, sessionID, namespace, resourceType, name)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []ContainerImage{}
+	patchLists := map[string][]interface{}{}
+	for _, containerName := range sortedKeys(images) {
+		field, container, err := findPodSpecContainer(object, kind, podSpecPath, containerName)
+		if err != nil {
+			return nil, err
+		}
+		previousImage, _ := container["image"].(string)
+		containerType := "container"
+		if field == "initContainers" {
+			containerType = "initContainer"
+		}
+		changes = append(changes, ContainerImage{Container: containerName, Type: containerType, Image: images[containerName], PreviousImage: previousImage})
+		patchLists[field] = append(patchLists[field], map[string]interface{}{"name": containerName, "image": images[containerName]})
+	}
+
+	patch, err := podSpecPatch(podSpecPath, object.GetResourceVersion(), patchLists)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resource.Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(changes))
+	for _, change := range changes {
+		names = append(names, change.Container)
+	}
+	return &SetImageResponse{
+		Namespace:  namespace,
+		Kind:       kind,
+		Name:       name,
+		Containers: changes,
+		Status:     true,
+		Message:    fmt.Sprintf("image of %s in %s %s successfully updated", strings.Join(names, ", "), kind, name),
+	}, nil
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SetImage sets the images of one or more containers of a workload or pod.
+func SetImage(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get("X-Session-Id")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	resourceType := vars["resource_type"]
+	namespaceName := vars["namespace_name"]
+	resourceName := vars["resource_name"]
+
+	var request SetImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("failed to unmarshal JSON request: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if len(request.Containers) == 0 {
+		http.Error(w, "containers must be provided", http.StatusBadRequest)
+		return
+	}
+	for containerName, image := range request.Containers {
+		if containerName == "" || strings.TrimSpace(image) == "" {
+			http.Error(w, "every container must have a name and an image", http.StatusBadRequest)
+			return
+		}
+	}
+
+	response, err := K8sSetImage(r.Context(), sessionID, namespaceName, resourceType, resourceName, request.Containers)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error setting image of %s: %s: %s", resourceType, resourceName, err.Error()), k8sErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding JSON response: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+}
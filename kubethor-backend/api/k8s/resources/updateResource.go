@@ -15,6 +15,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // UpdateResource updates a resource.
@@ -57,9 +58,17 @@ func K8sUpdateResource(sessionID, namespace, resourceType string, resourceData i
 		return userData.Clientset.CoreV1().Nodes().Update(context.TODO(), resourceData.(*corev1.Node), metav1.UpdateOptions{})
 	case "Event":
 		return userData.Clientset.CoreV1().Events(namespace).Update(context.TODO(), resourceData.(*corev1.Event), metav1.UpdateOptions{})
-	// Add cases for other resource types as needed
 	default:
-		return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
+		// Any other kind (StatefulSet, DaemonSet, CRDs, ...) is resolved through discovery
+		object, ok := resourceData.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type for resource type %s", resourceType)
+		}
+		resource, _, err := k8sclient.GetDynamicResource(userData, resourceType, namespace)
+		if err != nil {
+			return nil, err
+		}
+		return resource.Update(context.TODO(), object, metav1.UpdateOptions{})
 	}
 }
 
@@ -188,11 +197,16 @@ func UpdateDeploymentContainerImageDetails(sessionID, namespace, deploymentName,
 	}
 
 	// Modify the container image in the Deployment data
+	found := false
 	for i, container := range deployment.Spec.Template.Spec.Containers {
 		if container.Name == containerName {
 			deployment.Spec.Template.Spec.Containers[i].Image = newValue
+			found = true
 		}
 	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s in Deployment %s", ErrContainerNotFound, containerName, deploymentName)
+	}
 
 	// Update the ConfigMap in the cluster
 	updatedDeployment, err := K8sUpdateResource(sessionID, namespace, "Deployment", deployment)
@@ -236,7 +250,7 @@ func UpdateDeploymentContainerImage(w http.ResponseWriter, r *http.Request) {
 	// Call the function to update the Deployment Container Image
 	updatedDeployment, err := UpdateDeploymentContainerImageDetails(sessionID, namespaceName, deploymentName, containerName, newValue)
 	if err != nil {
-		http.Error(w, "Error updating Container Image: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Error updating Container Image: "+err.Error(), k8sErrorStatus(err))
 		return
 	}
 
@@ -0,0 +1,98 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	k8sclient "kubethor-backend/api"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// workloadKinds maps the accepted spellings of a workload kind, kubectl's short names included, to the kind
+var workloadKinds = map[string]string{
+	"deployment":   "Deployment",
+	"deployments":  "Deployment",
+	"deploy":       "Deployment",
+	"statefulset":  "StatefulSet",
+	"statefulsets": "StatefulSet",
+	"sts":          "StatefulSet",
+	"daemonset":    "DaemonSet",
+	"daemonsets":   "DaemonSet",
+	"ds":           "DaemonSet",
+	"replicaset":   "ReplicaSet",
+	"replicasets":  "ReplicaSet",
+	"rs":           "ReplicaSet",
+	"job":          "Job",
+	"jobs":         "Job",
+}
+
+// ParseWorkload parses a workload written as kind/name, e.g. deployment/checkout or sts/redis.
+func ParseWorkload(workload string) (string, string, error) {
+	kind, name, found := strings.Cut(workload, "/")
+	if !found || name == "" {
+		return "", "", fmt.Errorf("invalid workload: %s, must be kind/name", workload)
+	}
+	normalizedKind, ok := workloadKinds[strings.ToLower(kind)]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported workload kind: %s, must be one of Deployment, StatefulSet, DaemonSet, ReplicaSet or Job", kind)
+	}
+	return normalizedKind, name, nil
+}
+
+// K8sWorkloadSelector returns the label selector of the pods managed by the workload.
+func K8sWorkloadSelector(ctx context.Context, userData *k8sclient.UserData, namespace, kind, name string) (string, error) {
+	// Check if clientset is properly initialized
+	if userData.Clientset == nil {
+		return "", fmt.Errorf("clientset is nil, clientset not properly initialized")
+	}
+
+	var labelSelector *metav1.LabelSelector
+	switch kind {
+	case "Deployment":
+		deployment, err := userData.Clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		labelSelector = deployment.Spec.Selector
+	case "StatefulSet":
+		statefulSet, err := userData.Clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		labelSelector = statefulSet.Spec.Selector
+	case "DaemonSet":
+		daemonSet, err := userData.Clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		labelSelector = daemonSet.Spec.Selector
+	case "ReplicaSet":
+		replicaSet, err := userData.Clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		labelSelector = replicaSet.Spec.Selector
+	case "Job":
+		job, err := userData.Clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		labelSelector = job.Spec.Selector
+	default:
+		return "", fmt.Errorf("unsupported workload kind: %s", kind)
+	}
+
+	if labelSelector == nil {
+		return "", fmt.Errorf("%s %s has no pod selector", kind, name)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return "", fmt.Errorf("invalid selector of %s %s: %s", kind, name, err.Error())
+	}
+	// An empty selector would match every pod of the namespace
+	if selector.Empty() {
+		return "", fmt.Errorf("%s %s has no pod selector", kind, name)
+	}
+	return selector.String(), nil
+}
@@ -0,0 +1,361 @@
+package resourceslistwatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	k8sclient "kubethor-backend/api"
+	"kubethor-backend/api/k8s/resources"
+	config "kubethor-backend/config"
+
+	"github.com/gorilla/mux"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Containers tailed at once by one aggregated log stream, like stern's --max-log-requests
+const maxAggregatedLogStreams = 50
+
+// PodLogLineMessage is a line of an aggregated log stream tagged with its pod and container. Event messages
+// (tailing | stopped) tell when a container is picked up or its log ended and carry no line.
+type PodLogLineMessage struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Event     string `json:"event,omitempty"`
+	*LogMessage
+}
+
+// WatchAggregatedPodLogs tails every container of the pods matching a label selector or managed by a workload,
+// like stern. Pods that appear later are picked up through a watch.
+func WatchAggregatedPodLogs(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve user data using session ID
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	namespace := vars["namespace_name"]
+
+	// Either a labelSelector or a workload query parameter, e.g. ?workload=deployment/checkout
+	labelSelector := r.URL.Query().Get("labelSelector")
+	workload := r.URL.Query().Get("workload")
+	if (labelSelector == "") == (workload == "") {
+		http.Error(w, "exactly one of labelSelector or workload must be provided", http.StatusBadRequest)
+		return
+	}
+	var workloadKind, workloadName string
+	if workload != "" {
+		if namespace == k8sclient.AllNamespaces {
+			http.Error(w, "a workload can't be used with all namespaces", http.StatusBadRequest)
+			return
+		}
+		if workloadKind, workloadName, err = resources.ParseWorkload(workload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if _, err := k8sclient.NewResourceSelector(labelSelector, ""); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Optional container query parameter, a regular expression the container names must match
+	var containerFilter *regexp.Regexp
+	if container := r.URL.Query().Get("container"); container != "" {
+		if containerFilter, err = regexp.Compile(container); err != nil {
+			http.Error(w, fmt.Sprintf("invalid container: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Optional log options and filter, applied to every container
+	options, err := resources.GetLogOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := GetLogFilterOptions(r).LogFilter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conn, err := config.WebSocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	queue := newSendQueue(conn)
+	defer queue.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Stop tailing once the client disconnects
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				queue.Abort(err)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	sendError := func(errMsg ErrorMessage) {
+		errJSON, _ := json.Marshal(errMsg)
+		queue.Send(errJSON)
+	}
+
+	if workload != "" {
+		if labelSelector, err = resources.K8sWorkloadSelector(ctx, userData, namespace, workloadKind, workloadName); err != nil {
+			sendError(ErrorMessage{Error: fmt.Sprintf("Workload: %s logs", workload), K8sError: err.Error()})
+			return
+		}
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	eventsCh, err := K8sWatchResources(sessionID, namespace, "Pod", k8sclient.ResourceSelector{LabelSelector: labelSelector}, stopCh)
+	if err != nil {
+		sendError(ErrorMessage{Error: fmt.Sprintf("Pods: %s logs", labelSelector), K8sError: err.Error()})
+		return
+	}
+
+	aggregator := newPodLogAggregator(ctx, userData, options, filter, containerFilter, queue.Send)
+	defer aggregator.stop()
+
+	for {
+		select {
+		case event, ok := <-eventsCh:
+			if !ok {
+				return
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				if pod, ok := event.Object.(*corev1.Pod); ok {
+					aggregator.tailPod(pod)
+				}
+			case watch.Deleted:
+				if pod, ok := event.Object.(*corev1.Pod); ok {
+					aggregator.stopPod(pod)
+				}
+			case watch.Error:
+				errMsg := ErrorMessage{Error: fmt.Sprintf("Pods: %s logs - watch interrupted", labelSelector)}
+				if status, ok := event.Object.(*metav1.Status); ok {
+					errMsg.K8sError = status.Message
+				}
+				sendError(errMsg)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// podLogTail is a container log being tailed, or that was, for the instance with restartCount
+type podLogTail struct {
+	restartCount int32
+	cancel       context.CancelFunc
+	done         bool
+}
+
+// podLogAggregator tails the containers of the watched pods and interleaves their lines on one connection.
+type podLogAggregator struct {
+	ctx             context.Context
+	cancel          context.CancelFunc
+	userData        *k8sclient.UserData
+	logOptions      resources.LogOptions
+	filter          *LogFilter
+	containerFilter *regexp.Regexp
+	send            func(jsonData []byte) error
+	seq             uint64
+	sendMutex       sync.Mutex
+	tails           map[string]*podLogTail
+	// waiting are the pods with containers over the limit of tails, retried whenever a tail ends.
+	// The containers in rejected were already told about the limit.
+	waiting  map[string]*corev1.Pod
+	rejected map[string]bool
+	mutex    sync.Mutex
+	wg       sync.WaitGroup
+}
+
+func newPodLogAggregator(ctx context.Context, userData *k8sclient.UserData, logOptions resources.LogOptions, filter *LogFilter, containerFilter *regexp.Regexp, send func(jsonData []byte) error) *podLogAggregator {
+	ctx, cancel := context.WithCancel(ctx)
+	return &podLogAggregator{
+		ctx:             ctx,
+		cancel:          cancel,
+		userData:        userData,
+		logOptions:      logOptions,
+		filter:          filter,
+		containerFilter: containerFilter,
+		send:            send,
+		tails:           make(map[string]*podLogTail),
+		waiting:         make(map[string]*corev1.Pod),
+		rejected:        make(map[string]bool),
+	}
+}
+
+// tailPod starts tailing the containers of the pod that have a log and aren't tailed yet. A restarted
+// container is tailed again for its new instance, the log of the previous one ends on its own.
+func (a *podLogAggregator) tailPod(pod *corev1.Pod) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.tailPodLocked(pod)
+}
+
+// tailPodLocked must be called with the mutex held
+func (a *podLogAggregator) tailPodLocked(pod *corev1.Pod) {
+	podKey := pod.Namespace + "/" + pod.Name
+	waiting := false
+	// Init containers too, a pod stuck initializing only logs from them
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if a.containerFilter != nil && !a.containerFilter.MatchString(status.Name) {
+			continue
+		}
+		// A waiting container has no log yet
+		if status.State.Running == nil && status.State.Terminated == nil {
+			continue
+		}
+
+		key := podKey + "/" + status.Name
+		tail, ok := a.tails[key]
+		if ok && tail.restartCount == status.RestartCount {
+			continue
+		}
+
+		if a.activeTailsLocked() >= maxAggregatedLogStreams {
+			waiting = true
+			if !a.rejected[key] {
+				a.rejected[key] = true
+				a.sendError(pod.Name, status.Name, fmt.Errorf("maximum of %d containers tailed at once reached, narrow the selector", maxAggregatedLogStreams))
+			}
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(a.ctx)
+		tail = &podLogTail{restartCount: status.RestartCount, cancel: cancel}
+		a.tails[key] = tail
+		delete(a.rejected, key)
+		a.wg.Add(1)
+		go a.tailContainer(ctx, tail, pod.Namespace, pod.Name, status.Name)
+	}
+
+	if waiting {
+		a.waiting[podKey] = pod
+	} else {
+		delete(a.waiting, podKey)
+	}
+}
+
+// stopPod stops tailing the containers of a deleted pod
+func (a *podLogAggregator) stopPod(pod *corev1.Pod) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	prefix := pod.Namespace + "/" + pod.Name + "/"
+	for key, tail := range a.tails {
+		if strings.HasPrefix(key, prefix) {
+			tail.cancel()
+			delete(a.tails, key)
+		}
+	}
+	for key := range a.rejected {
+		if strings.HasPrefix(key, prefix) {
+			delete(a.rejected, key)
+		}
+	}
+	delete(a.waiting, pod.Namespace+"/"+pod.Name)
+}
+
+// activeTailsLocked must be called with the mutex held
+func (a *podLogAggregator) activeTailsLocked() int {
+	active := 0
+	for _, tail := range a.tails {
+		if !tail.done {
+			active++
+		}
+	}
+	return active
+}
+
+// stop stops every tail and waits for them to end
+func (a *podLogAggregator) stop() {
+	a.cancel()
+	a.wg.Wait()
+}
+
+func (a *podLogAggregator) tailContainer(ctx context.Context, tail *podLogTail, namespace, podName, containerName string) {
+	defer a.wg.Done()
+	defer tail.cancel()
+
+	a.sendMessage(PodLogLineMessage{Namespace: namespace, Pod: podName, Container: containerName, Event: "tailing"})
+
+	// The options were validated by the handler
+	logOptions, _ := a.logOptions.PodLogOptions(containerName, true)
+	err := k8sStreamPodLogLines(ctx, a.userData, namespace, podName, logOptions, a.filter, func(line logLine) error {
+		return a.sendMessage(PodLogLineMessage{
+			Namespace:  namespace,
+			Pod:        podName,
+			Container:  containerName,
+			LogMessage: newLogMessage(0, line),
+		})
+	})
+
+	a.mutex.Lock()
+	tail.done = true
+	// The ended tail frees a place for the containers over the limit
+	if a.ctx.Err() == nil {
+		for _, pod := range a.waiting {
+			a.tailPodLocked(pod)
+		}
+	}
+	a.mutex.Unlock()
+
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		a.sendError(podName, containerName, err)
+	}
+	a.sendMessage(PodLogLineMessage{Namespace: namespace, Pod: podName, Container: containerName, Event: "stopped"})
+}
+
+// sendMessage numbers the log lines in the order they are sent, across every container
+func (a *podLogAggregator) sendMessage(message PodLogLineMessage) error {
+	a.sendMutex.Lock()
+	defer a.sendMutex.Unlock()
+
+	if message.LogMessage != nil {
+		a.seq++
+		message.LogMessage.Seq = a.seq
+	}
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return a.send(jsonData)
+}
+
+func (a *podLogAggregator) sendError(podName, containerName string, err error) {
+	errMsg, _ := json.Marshal(ErrorMessage{Error: fmt.Sprintf("Pod: %s container: %s logs", podName, containerName), K8sError: err.Error()})
+	a.sendMutex.Lock()
+	defer a.sendMutex.Unlock()
+	a.send(errMsg)
+}
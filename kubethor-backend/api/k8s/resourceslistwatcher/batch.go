@@ -0,0 +1,66 @@
+package resourceslistwatcher
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultBatchInterval = 250 * time.Millisecond
+	defaultBatchSize     = 100
+	maxBatchInterval     = 10 * time.Second
+	maxBatchSize         = 1000
+)
+
+// BatchOptions groups watch events into JSON array frames, flushed every Interval or once Size events are waiting.
+// The zero value disables batching, every event is sent as its own frame.
+type BatchOptions struct {
+	Interval time.Duration
+	Size     int
+}
+
+// Enabled reports whether events are sent in batches
+func (b BatchOptions) Enabled() bool {
+	return b.Size > 0
+}
+
+// GetBatchOptions reads the batchInterval and batchSize query parameters,
+// e.g. ?batchInterval=250ms&batchSize=100
+func GetBatchOptions(r *http.Request) (BatchOptions, error) {
+	size := 0
+	if sizeParam := r.URL.Query().Get("batchSize"); sizeParam != "" {
+		var err error
+		size, err = strconv.Atoi(sizeParam)
+		if err != nil {
+			return BatchOptions{}, fmt.Errorf("invalid batchSize: %s", sizeParam)
+		}
+	}
+	return NewBatchOptions(r.URL.Query().Get("batchInterval"), size)
+}
+
+// NewBatchOptions validates the batch interval and size. Batching is enabled when either is set,
+// the other one falls back to its default.
+func NewBatchOptions(interval string, size int) (BatchOptions, error) {
+	if interval == "" && size == 0 {
+		return BatchOptions{}, nil
+	}
+
+	batch := BatchOptions{Interval: defaultBatchInterval, Size: defaultBatchSize}
+	if interval != "" {
+		duration, err := time.ParseDuration(interval)
+		if err != nil || duration <= 0 || duration > maxBatchInterval {
+			return BatchOptions{}, fmt.Errorf("invalid batchInterval: %s, must be a duration up to %s", interval, maxBatchInterval)
+		}
+		batch.Interval = duration
+	}
+	if size != 0 {
+		if size < 0 || size > maxBatchSize {
+			return BatchOptions{}, fmt.Errorf("invalid batchSize: %d, must be between 1 and %d", size, maxBatchSize)
+		}
+		batch.Size = size
+	}
+
+	return batch, nil
+}
@@ -1,16 +1,20 @@
 package resourceslistwatcher
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	k8sclient "kubethor-backend/api"
+	"log"
 	"net"
 	"net/http"
+	"sync"
 
 	"github.com/gorilla/websocket"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
 )
 
 var machineConnections = make(map[string]*websocket.Conn)
@@ -20,6 +24,23 @@ type ErrorMessage struct {
 	K8sError string `json:"k8sError,omitempty"`
 }
 
+// Synced is the event type sent once the initial list of resources has been delivered
+const Synced watch.EventType = "SYNCED"
+
+// Resumed is the event type sent once an interrupted watch is re-established
+const Resumed watch.EventType = "RESUMED"
+
+// Lagging is the event type sent when the client reads slower than events arrive, its list is stale and
+// a fresh snapshot followed by SYNCED is sent once it caught up
+const Lagging watch.EventType = "LAGGING"
+
+// WatchStatusMessage tells the client the initial list is complete, the interrupted watch resumed
+// or the client is lagging, every following message is incremental
+type WatchStatusMessage struct {
+	EventType       string `json:"eventType"`
+	ResourceVersion string `json:"resourceVersion"`
+}
+
 // Get the remote machine's IP address and check for an existing WebSocket connection
 func getCheckClientIPAddress(w http.ResponseWriter, r *http.Request) (string, error) {
 	// Get the remote machine's IP address
@@ -38,7 +59,9 @@ func getCheckClientIPAddress(w http.ResponseWriter, r *http.Request) (string, er
 }
 
 // WatchResources watches for changes to resources of a specific type.
-func K8sWatchResources(sessionID, namespace, resourceType string, stopCh <-chan struct{}) (<-chan watch.Event, error) {
+// Every subscriber is served from the session's shared informer, so only one watch per kind/namespace
+// is opened against the API server no matter how many WebSockets are listening.
+func K8sWatchResources(sessionID, namespace, resourceType string, selector k8sclient.ResourceSelector, stopCh <-chan struct{}) (<-chan watch.Event, error) {
 	// Retrieve user data using session ID
 	userData, err := k8sclient.GetSession(sessionID)
 	if err != nil {
@@ -50,72 +73,222 @@ func K8sWatchResources(sessionID, namespace, resourceType string, stopCh <-chan
 		return nil, fmt.Errorf("clientset is nil, clientset not properly initialized")
 	}
 
-	resourceWatch := func() (watch.Interface, error) {
-		switch resourceType {
-		case "Pod":
-			return userData.Clientset.CoreV1().Pods(namespace).Watch(context.Background(), metav1.ListOptions{})
-		case "Deployment":
-			return userData.Clientset.AppsV1().Deployments(namespace).Watch(context.Background(), metav1.ListOptions{})
-		case "ConfigMap":
-			return userData.Clientset.CoreV1().ConfigMaps(namespace).Watch(context.Background(), metav1.ListOptions{})
-		case "Job":
-			return userData.Clientset.BatchV1().Jobs(namespace).Watch(context.Background(), metav1.ListOptions{})
-		case "Service":
-			return userData.Clientset.CoreV1().Services(namespace).Watch(context.Background(), metav1.ListOptions{})
-		case "Secret":
-			return userData.Clientset.CoreV1().Secrets(namespace).Watch(context.Background(), metav1.ListOptions{})
-		case "HorizontalPodAutoscaler":
-			return userData.Clientset.AutoscalingV1().HorizontalPodAutoscalers(namespace).Watch(context.Background(), metav1.ListOptions{})
-		case "Ingress":
-			return userData.Clientset.NetworkingV1().Ingresses(namespace).Watch(context.Background(), metav1.ListOptions{})
-		case "Endpoints":
-			return userData.Clientset.CoreV1().Endpoints(namespace).Watch(context.Background(), metav1.ListOptions{})
-		case "ServiceAccount":
-			return userData.Clientset.CoreV1().ServiceAccounts(namespace).Watch(context.Background(), metav1.ListOptions{})
-		case "PersistentVolumeClaim":
-			return userData.Clientset.CoreV1().PersistentVolumeClaims(namespace).Watch(context.Background(), metav1.ListOptions{})
-		case "Namespace":
-			return userData.Clientset.CoreV1().Namespaces().Watch(context.Background(), metav1.ListOptions{})
-		case "Node":
-			return userData.Clientset.CoreV1().Nodes().Watch(context.Background(), metav1.ListOptions{})
-		case "Event":
-			return userData.Clientset.CoreV1().Events(namespace).Watch(context.Background(), metav1.ListOptions{})
-			// Add cases for other resource types as needed
-		default:
-			return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
-		}
+	if namespace == k8sclient.AllNamespaces {
+		return k8sWatchResourcesAllNamespaces(userData, resourceType, selector, stopCh)
 	}
 
-	watcher, err := resourceWatch()
+	informer, release, err := k8sclient.GetResourceInformer(userData, resourceType, namespace, selector)
 	if err != nil {
 		return nil, err
 	}
 
 	eventsCh := make(chan watch.Event)
 
-	go K8sWatchEvents(watcher, stopCh, eventsCh)
+	go watchInformerEvents(informer, release, stopCh, eventsCh)
 
 	return eventsCh, nil
 }
 
-// WatchK8sEvents receives k8s events from the watcher and sends them to the channel.
-func K8sWatchEvents(watcher watch.Interface, stopCh <-chan struct{}, eventsCh chan<- watch.Event) {
-	defer close(eventsCh)
-	watcherStopped := false // Flag to track whether the watcher has stopped
-	for {
+// watchInformerEvents forwards the informer's events until stopCh is closed, then releases the informer
+// so it stops once its last subscriber is gone.
+func watchInformerEvents(informer *k8sclient.ResourceInformer, release func(), stopCh <-chan struct{}, eventsCh chan<- watch.Event) {
+	defer release()
+	K8sWatchEvents(informer, stopCh, eventsCh)
+}
+
+// k8sWatchResourcesAllNamespaces watches across all namespaces with one cluster-wide informer. When RBAC forbids
+// cluster-wide access it falls back to one informer per namespace the user can list and merges their events.
+func k8sWatchResourcesAllNamespaces(userData *k8sclient.UserData, resourceType string, selector k8sclient.ResourceSelector, stopCh <-chan struct{}) (<-chan watch.Event, error) {
+	informer, release, err := k8sclient.GetResourceInformer(userData, resourceType, metav1.NamespaceAll, selector)
+	if err == nil {
+		eventsCh := make(chan watch.Event)
+		go watchInformerEvents(informer, release, stopCh, eventsCh)
+		return eventsCh, nil
+	}
+	if !apierrors.IsForbidden(err) {
+		return nil, err
+	}
+
+	var namespaceInformers []*k8sclient.ResourceInformer
+	var releases []func()
+	for _, namespace := range k8sclient.GetSessionNamespaces(userData) {
+		namespaceInformer, namespaceRelease, namespaceErr := k8sclient.GetResourceInformer(userData, resourceType, namespace, selector)
+		if apierrors.IsForbidden(namespaceErr) {
+			continue
+		}
+		if namespaceErr != nil {
+			for _, release := range releases {
+				release()
+			}
+			return nil, namespaceErr
+		}
+		namespaceInformers = append(namespaceInformers, namespaceInformer)
+		releases = append(releases, namespaceRelease)
+	}
+	if len(namespaceInformers) == 0 {
+		return nil, err
+	}
+
+	var namespaceEventsChs []<-chan watch.Event
+	for i, namespaceInformer := range namespaceInformers {
+		namespaceEventsCh := make(chan watch.Event)
+		go watchInformerEvents(namespaceInformer, releases[i], stopCh, namespaceEventsCh)
+		namespaceEventsChs = append(namespaceEventsChs, namespaceEventsCh)
+	}
+
+	log.Printf("Cluster-wide %s watch forbidden, watching %d accessible namespaces instead", resourceType, len(namespaceEventsChs))
+
+	eventsCh := make(chan watch.Event)
+	go mergeWatchEvents(namespaceEventsChs, stopCh, eventsCh)
+
+	return eventsCh, nil
+}
+
+// mergeWatchEvents forwards the events of several watchers to one channel. The SYNCED marker is only
+// forwarded once every watcher has delivered its initial list, without a resourceVersion as there are many.
+func mergeWatchEvents(inputs []<-chan watch.Event, stopCh <-chan struct{}, eventsCh chan<- watch.Event) {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	syncedCount := 0
+
+	for _, input := range inputs {
+		wg.Add(1)
+		go func(input <-chan watch.Event) {
+			defer wg.Done()
+			for event := range input {
+				if event.Type == Synced {
+					mutex.Lock()
+					syncedCount++
+					allSynced := syncedCount == len(inputs)
+					mutex.Unlock()
+					if !allSynced {
+						continue
+					}
+					event = watch.Event{Type: Synced, Object: &metav1.PartialObjectMetadata{}}
+				}
+				select {
+				case eventsCh <- event:
+				case <-stopCh:
+				}
+			}
+		}(input)
+	}
+
+	wg.Wait()
+	close(eventsCh)
+}
+
+// WatchK8sEvents receives k8s events from the shared informer and sends them to the channel.
+// The cached objects are sent first as ADDED events, followed by a single SYNCED event carrying the
+// resourceVersion of the list, and only then the incremental ADDED/MODIFIED/DELETED events.
+func K8sWatchEvents(informer *k8sclient.ResourceInformer, stopCh <-chan struct{}, eventsCh chan<- watch.Event) {
+	var mutex sync.Mutex
+	closed := false
+	synced := false
+
+	// sendLocked must be called with the mutex held
+	sendLocked := func(event watch.Event) {
+		if closed {
+			return
+		}
 		select {
+		case eventsCh <- event:
 		case <-stopCh:
-			if !watcherStopped {
-				watcherStopped = true
-				watcher.Stop()
-			}
+		}
+	}
+
+	// markSyncedLocked must be called with the mutex held
+	markSyncedLocked := func() {
+		if synced {
+			return
+		}
+		synced = true
+		sendLocked(watch.Event{
+			Type: Synced,
+			Object: &metav1.PartialObjectMetadata{
+				ObjectMeta: metav1.ObjectMeta{ResourceVersion: informer.LastSyncResourceVersion()},
+			},
+		})
+	}
+
+	send := func(eventType watch.EventType, obj interface{}, isInInitialList bool) {
+		// Deletes missed while the watch was down arrive wrapped in a tombstone
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		object, ok := obj.(runtime.Object)
+		if !ok {
 			return
-		case event, ok := <-watcher.ResultChan():
-			if !ok {
-				eventsCh <- watch.Event{Type: watch.Error}
-				return
-			}
-			eventsCh <- event
 		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !isInInitialList {
+			markSyncedLocked()
+		}
+		sendLocked(watch.Event{Type: eventType, Object: object})
+	}
+
+	// Registering the handler replays the cached objects as ADDED events before any update
+	registration, err := informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			send(watch.Added, obj, isInInitialList)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			send(watch.Modified, newObj, false)
+		},
+		DeleteFunc: func(obj interface{}) {
+			send(watch.Deleted, obj, false)
+		},
+	})
+	if err != nil {
+		eventsCh <- watch.Event{Type: watch.Error, Object: &metav1.Status{Message: err.Error()}}
+		close(eventsCh)
+		return
 	}
+
+	// Subscribers only hear about the watch when the cluster can't be reached, routine expiry is resumed silently.
+	// sendWatchStatusLocked must be called with the mutex held
+	sendWatchStatusLocked := func(err error) {
+		if err != nil {
+			sendLocked(watch.Event{Type: watch.Error, Object: &metav1.Status{Message: err.Error()}})
+			return
+		}
+		sendLocked(watch.Event{
+			Type: Resumed,
+			Object: &metav1.PartialObjectMetadata{
+				ObjectMeta: metav1.ObjectMeta{ResourceVersion: informer.LastSyncResourceVersion()},
+			},
+		})
+	}
+
+	// An interrupted watch is reported before any status change that follows the registration
+	mutex.Lock()
+	removeWatchStatusHandler, watchErr := informer.AddWatchStatusHandler(func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		sendWatchStatusLocked(err)
+	})
+	if watchErr != nil {
+		sendWatchStatusLocked(watchErr)
+	}
+	mutex.Unlock()
+
+	// The handler has synced once every object of the initial list was delivered, empty lists included
+	go func() {
+		if cache.WaitForCacheSync(stopCh, registration.HasSynced) {
+			mutex.Lock()
+			markSyncedLocked()
+			mutex.Unlock()
+		}
+	}()
+
+	<-stopCh
+	removeWatchStatusHandler()
+	informer.RemoveEventHandler(registration)
+
+	mutex.Lock()
+	closed = true
+	close(eventsCh)
+	mutex.Unlock()
 }
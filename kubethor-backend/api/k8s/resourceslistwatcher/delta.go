@@ -0,0 +1,224 @@
+package resourceslistwatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// DeltaMode selects how MODIFIED events are sent, the empty mode sends the full summary every time.
+type DeltaMode string
+
+const (
+	// DeltaJSONPatch sends an RFC 6902 JSON Patch against the last summary sent for the object
+	DeltaJSONPatch DeltaMode = "jsonpatch"
+	// DeltaMergePatch sends an RFC 7386 JSON Merge Patch against the last summary sent for the object
+	DeltaMergePatch DeltaMode = "merge"
+)
+
+// DeltaMessage is sent instead of the full summary for a MODIFIED event in delta mode,
+// the patch applies to the last summary received for the object with the same name and namespace.
+type DeltaMessage struct {
+	EventType string          `json:"eventType"`
+	Name      string          `json:"name"`
+	Namespace string          `json:"namespace,omitempty"`
+	Patch     json.RawMessage `json:"patch"`
+}
+
+// GetDeltaMode reads the delta query parameter, e.g. ?delta=jsonpatch
+func GetDeltaMode(r *http.Request) (DeltaMode, error) {
+	return NewDeltaMode(r.URL.Query().Get("delta"))
+}
+
+// NewDeltaMode validates the delta mode, empty disables delta streaming.
+func NewDeltaMode(mode string) (DeltaMode, error) {
+	switch DeltaMode(mode) {
+	case "", DeltaJSONPatch, DeltaMergePatch:
+		return DeltaMode(mode), nil
+	}
+	return "", fmt.Errorf("invalid delta: %s, must be %s or %s", mode, DeltaJSONPatch, DeltaMergePatch)
+}
+
+// deltaTracker remembers the last summary sent per object UID. A tracker lives as long as one watch,
+// so after a resync every object is sent in full again.
+type deltaTracker struct {
+	mode    DeltaMode
+	objects map[types.UID]*deltaState
+}
+
+// deltaState is what the client holds of an object: sent once every queued message is delivered,
+// base before the last queued message, which a coalesced message has to be diffed against instead.
+type deltaState struct {
+	base interface{}
+	sent interface{}
+}
+
+func newDeltaTracker(mode DeltaMode) *deltaTracker {
+	return &deltaTracker{mode: mode, objects: make(map[types.UID]*deltaState)}
+}
+
+// message returns the message to send for the event, the full summary for objects the client doesn't hold yet,
+// a DeltaMessage otherwise. coalesced tells whether it replaces the last message queued for the object.
+// A nil message means nothing changed. It falls back to the full summary whenever no delta can be built.
+func (t *deltaTracker) message(event watch.Event, respJSON []byte, coalesced bool) []byte {
+	if t == nil {
+		return respJSON
+	}
+	objectMeta, err := meta.Accessor(event.Object)
+	if err != nil || objectMeta.GetUID() == "" {
+		return respJSON
+	}
+	uid := objectMeta.GetUID()
+
+	var summary interface{}
+	if err := json.Unmarshal(respJSON, &summary); err != nil {
+		return respJSON
+	}
+
+	state, exists := t.objects[uid]
+	switch {
+	case event.Type == watch.Deleted:
+		delete(t.objects, uid)
+		return respJSON
+	case event.Type != watch.Modified || !exists:
+		t.objects[uid] = &deltaState{sent: summary}
+		return respJSON
+	}
+
+	base := state.sent
+	if coalesced {
+		base = state.base
+	} else {
+		state.base = state.sent
+	}
+	state.sent = summary
+
+	// The replaced message was the full summary, so is its replacement
+	if base == nil {
+		return respJSON
+	}
+
+	var patch interface{}
+	if t.mode == DeltaMergePatch {
+		mergePatch, changed := createMergePatch(base, summary)
+		if !changed && !coalesced {
+			return nil
+		}
+		patch = mergePatch
+	} else {
+		operations := createJSONPatch(base, summary, "")
+		if len(operations) == 0 && !coalesced {
+			return nil
+		}
+		patch = operations
+	}
+
+	patchJSON, err := json.Marshal(patch)
+	if err != nil {
+		return respJSON
+	}
+	deltaJSON, err := json.Marshal(DeltaMessage{
+		EventType: string(event.Type),
+		Name:      objectMeta.GetName(),
+		Namespace: objectMeta.GetNamespace(),
+		Patch:     patchJSON,
+	})
+	if err != nil {
+		return respJSON
+	}
+	return deltaJSON
+}
+
+// JSONPatchOperation is an RFC 6902 operation
+type JSONPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// createJSONPatch returns the operations turning the decoded JSON document from into to.
+// Objects are diffed key by key, changed arrays and values are replaced as a whole.
+func createJSONPatch(from, to interface{}, path string) []JSONPatchOperation {
+	fromObject, fromIsObject := from.(map[string]interface{})
+	toObject, toIsObject := to.(map[string]interface{})
+	if !fromIsObject || !toIsObject {
+		if reflect.DeepEqual(from, to) {
+			return nil
+		}
+		// A null value has to be spelled out, omitempty would drop it
+		if to == nil {
+			return []JSONPatchOperation{{Op: "replace", Path: path, Value: json.RawMessage("null")}}
+		}
+		return []JSONPatchOperation{{Op: "replace", Path: path, Value: to}}
+	}
+
+	var operations []JSONPatchOperation
+	for _, key := range sortedKeys(fromObject) {
+		if _, ok := toObject[key]; !ok {
+			operations = append(operations, JSONPatchOperation{Op: "remove", Path: path + "/" + escapeJSONPointer(key)})
+		}
+	}
+	for _, key := range sortedKeys(toObject) {
+		keyPath := path + "/" + escapeJSONPointer(key)
+		fromValue, ok := fromObject[key]
+		if !ok {
+			value := toObject[key]
+			if value == nil {
+				value = json.RawMessage("null")
+			}
+			operations = append(operations, JSONPatchOperation{Op: "add", Path: keyPath, Value: value})
+			continue
+		}
+		operations = append(operations, createJSONPatch(fromValue, toObject[key], keyPath)...)
+	}
+	return operations
+}
+
+// createMergePatch returns the merge patch turning the decoded JSON document from into to, and whether it changes anything.
+// Removed keys and keys changed to null are both sent as null, as merge patches can't tell them apart.
+func createMergePatch(from, to interface{}) (interface{}, bool) {
+	fromObject, fromIsObject := from.(map[string]interface{})
+	toObject, toIsObject := to.(map[string]interface{})
+	if !fromIsObject || !toIsObject {
+		return to, !reflect.DeepEqual(from, to)
+	}
+
+	patch := make(map[string]interface{})
+	for key := range fromObject {
+		if _, ok := toObject[key]; !ok {
+			patch[key] = nil
+		}
+	}
+	for key, toValue := range toObject {
+		fromValue, ok := fromObject[key]
+		if !ok {
+			patch[key] = toValue
+			continue
+		}
+		if valuePatch, changed := createMergePatch(fromValue, toValue); changed {
+			patch[key] = valuePatch
+		}
+	}
+	return patch, len(patch) > 0
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapeJSONPointer escapes a key for use in an RFC 6901 JSON Pointer
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
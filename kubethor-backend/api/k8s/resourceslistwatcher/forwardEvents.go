@@ -0,0 +1,202 @@
+package resourceslistwatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	k8sclient "kubethor-backend/api"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// watchForwarder forwards the watch events of a resource type to a connection's send queue.
+type watchForwarder struct {
+	queue        *sendQueue
+	id           string // Keeps the coalesce keys of subscriptions sharing a queue apart
+	sessionID    string
+	namespace    string
+	resourceType string
+	selector     k8sclient.ResourceSelector
+	batch        BatchOptions
+	delta        DeltaMode
+	frame        func(data []byte) []byte // Wraps every frame before it is queued
+}
+
+// Start watches the resource type and queues its events until stopCh is closed or the watcher ends.
+// MODIFIED events of an object still waiting in the queue are replaced by its latest state. When the queue is full
+// the watcher is never blocked: the client gets a LAGGING message, and once it caught up the watch restarts with a
+// fresh snapshot and SYNCED. The first watch is started before returning, so its error can be reported to the client.
+func (f *watchForwarder) Start(stopCh <-chan struct{}) (<-chan struct{}, error) {
+	watchStopCh := make(chan struct{})
+	eventsCh, err := K8sWatchResources(f.sessionID, f.namespace, f.resourceType, f.selector, watchStopCh)
+	if err != nil {
+		return nil, err
+	}
+
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+
+		for {
+			lagging := f.queueEvents(eventsCh, stopCh)
+			close(watchStopCh)
+			if !lagging {
+				return
+			}
+
+			if err := f.sendMessage(WatchStatusMessage{EventType: string(Lagging)}); err != nil {
+				return
+			}
+			// Resync once the client has read half of its backlog
+			if err := f.queue.WaitBelow(sendQueueSize / 2); err != nil {
+				return
+			}
+			select {
+			case <-stopCh:
+				return
+			default:
+			}
+
+			watchStopCh = make(chan struct{})
+			eventsCh, err = K8sWatchResources(f.sessionID, f.namespace, f.resourceType, f.selector, watchStopCh)
+			if err != nil {
+				f.sendMessage(ErrorMessage{Error: fmt.Sprintf("Resource: %s for Namspace: %s - %s", f.resourceType, f.namespace, err)})
+				return
+			}
+		}
+	}()
+
+	return doneCh, nil
+}
+
+// queueEvents queues the events until stopCh is closed or the watcher ends, it returns true when the queue is full.
+func (f *watchForwarder) queueEvents(eventsCh <-chan watch.Event, stopCh <-chan struct{}) bool {
+	// Deltas are tracked per watch, the snapshot after a resync sends every object in full
+	var tracker *deltaTracker
+	if f.delta != "" {
+		tracker = newDeltaTracker(f.delta)
+	}
+
+	var batch []json.RawMessage
+	batchKeys := make(map[string]int)
+	var flushTimer *time.Timer
+	var flushCh <-chan time.Time
+	defer func() {
+		if flushTimer != nil {
+			flushTimer.Stop()
+		}
+	}()
+
+	// flush queues the waiting events as one JSON array frame, it returns false when the queue is full
+	flush := func() bool {
+		if flushTimer != nil {
+			flushTimer.Stop()
+			flushTimer, flushCh = nil, nil
+		}
+		if len(batch) == 0 {
+			return true
+		}
+		batchJSON, err := json.Marshal(batch)
+		batch = nil
+		clear(batchKeys)
+		if err != nil {
+			log.Println("Error marshaling event batch:", err)
+			return true
+		}
+		return f.queue.Offer("", f.frame(batchJSON))
+	}
+
+	for {
+		select {
+		case <-stopCh:
+			return false
+		case <-flushCh:
+			if !flush() {
+				return true
+			}
+		case event, ok := <-eventsCh:
+			if !ok {
+				flush()
+				return false
+			}
+			// Check if the event has a non-empty type and a non-nil object - watch.Event{Type:"", Object:runtime.Object(nil)}
+			if event.Type == "" || event.Object == nil {
+				continue
+			}
+			respJSON, err := processEvent(event, f.resourceType)
+			if err != nil {
+				log.Println("Error processing event:", err)
+				continue
+			}
+			key := coalesceKey(f.id, event)
+
+			if !f.batch.Enabled() {
+				queued := f.queue.OfferFunc(key, func(coalesced bool) []byte {
+					message := tracker.message(event, respJSON, coalesced)
+					if message == nil {
+						return nil
+					}
+					return f.frame(message)
+				})
+				if !queued {
+					return true
+				}
+				continue
+			}
+
+			// MODIFIED events of an object already in the batch replace it in place
+			if index, exists := batchKeys[key]; key != "" && exists {
+				batch[index] = tracker.message(event, respJSON, true)
+			} else {
+				message := tracker.message(event, respJSON, false)
+				if message == nil {
+					continue
+				}
+				if key != "" {
+					batchKeys[key] = len(batch)
+				}
+				batch = append(batch, message)
+			}
+
+			// Watch status messages are never held back
+			if len(batch) >= f.batch.Size || event.Type == Synced || event.Type == Resumed || event.Type == watch.Error {
+				if !flush() {
+					return true
+				}
+			} else if flushTimer == nil {
+				flushTimer = time.NewTimer(f.batch.Interval)
+				flushCh = flushTimer.C
+			}
+		}
+	}
+}
+
+// sendMessage queues a message outside of the event flow, as a one element array in batch mode.
+func (f *watchForwarder) sendMessage(message interface{}) error {
+	var messageJSON []byte
+	var err error
+	if f.batch.Enabled() {
+		messageJSON, err = json.Marshal([]interface{}{message})
+	} else {
+		messageJSON, err = json.Marshal(message)
+	}
+	if err != nil {
+		return err
+	}
+	return f.queue.Send(f.frame(messageJSON))
+}
+
+// coalesceKey returns the key MODIFIED events of the same object are coalesced by, other events are never coalesced.
+func coalesceKey(id string, event watch.Event) string {
+	if event.Type != watch.Modified {
+		return ""
+	}
+	objectMeta, err := meta.Accessor(event.Object)
+	if err != nil || objectMeta.GetUID() == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", id, objectMeta.GetUID())
+}
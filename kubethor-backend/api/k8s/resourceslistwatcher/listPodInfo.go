@@ -15,15 +15,17 @@ type PodInfo struct {
 	Namespace      string                       `json:"namespace"`
 	Containers     map[string]map[string]string `json:"containers"`
 	InitContainers map[string]map[string]string `json:"initContainers"`
-	Restarts       int32                        `json:"restarts"`
-	ControlledBy   string                       `json:"controlledBy"`
-	Node           string                       `json:"node"`
-	Qos            string                       `json:"qos"`
-	Age            string                       `json:"age"`
-	Status         string                       `json:"status"`
-	StatusReason   string                       `json:"statusReason"`
-	Labels         map[string]string            `json:"labels"`
-	EventType      string                       `json:"eventType"`
+	// Debug containers added through the ephemeralcontainers subresource
+	EphemeralContainers map[string]map[string]string `json:"ephemeralContainers"`
+	Restarts            int32                        `json:"restarts"`
+	ControlledBy        string                       `json:"controlledBy"`
+	Node                string                       `json:"node"`
+	Qos                 string                       `json:"qos"`
+	Age                 string                       `json:"age"`
+	Status              string                       `json:"status"`
+	StatusReason        string                       `json:"statusReason"`
+	Labels              map[string]string            `json:"labels"`
+	EventType           string                       `json:"eventType"`
 }
 
 // Process a Kubernetes Pod event and send data to the WebSocket client
@@ -79,6 +81,40 @@ func ListPodInfo(podData *corev1.Pod, eventType string) ([]byte, error) {
 		initContainers[containerName] = container
 	}
 
+	// Extract ephemeral container names, images, targets and statuses
+	ephemeralContainers := make(map[string]map[string]string)
+	for _, ephemeralContainer := range podData.Spec.EphemeralContainers {
+		containerName := ephemeralContainer.Name
+		// A container without a status yet hasn't been picked up by the kubelet
+		containerState := "waiting"
+		containerStartedAt := ""
+		containerStateReason := ""
+		for _, containerStatus := range podData.Status.EphemeralContainerStatuses {
+			if containerStatus.Name != containerName {
+				continue
+			}
+			if containerStatus.State.Running != nil {
+				containerState = "running"
+				containerStartedAt = containerStatus.State.Running.StartedAt.String()
+			} else if containerStatus.State.Waiting != nil {
+				containerStateReason = containerStatus.State.Waiting.Reason
+			} else if containerStatus.State.Terminated != nil {
+				containerState = "terminated"
+				containerStartedAt = containerStatus.State.Terminated.StartedAt.String()
+				containerStateReason = containerStatus.State.Terminated.Reason
+			}
+		}
+		container := map[string]string{
+			"containerName":        containerName,
+			"containerImage":       ephemeralContainer.Image,
+			"targetContainerName":  ephemeralContainer.TargetContainerName,
+			"containerState":       containerState,
+			"containerStateReason": containerStateReason,
+			"containerStartedAt":   containerStartedAt,
+		}
+		ephemeralContainers[containerName] = container
+	}
+
 	// Extract controlled by information
 	controlledBy := ""
 	if len(podData.OwnerReferences) > 0 {
@@ -105,18 +141,19 @@ func ListPodInfo(podData *corev1.Pod, eventType string) ([]byte, error) {
 
 	// Create a PodInfo struct with the relevant data
 	podInfo := PodInfo{
-		Name:           podData.Name,
-		Namespace:      podData.Namespace,
-		Containers:     containers,
-		InitContainers: initContainers,
-		ControlledBy:   controlledBy,
-		Node:           node,
-		Qos:            qos,
-		Age:            age,
-		Status:         podStatus,
-		StatusReason:   podStatusReason,
-		Labels:         labels,
-		EventType:      eventType,
+		Name:                podData.Name,
+		Namespace:           podData.Namespace,
+		Containers:          containers,
+		InitContainers:      initContainers,
+		EphemeralContainers: ephemeralContainers,
+		ControlledBy:        controlledBy,
+		Node:                node,
+		Qos:                 qos,
+		Age:                 age,
+		Status:              podStatus,
+		StatusReason:        podStatusReason,
+		Labels:              labels,
+		EventType:           eventType,
 	}
 
 	// Check if there are container statuses available
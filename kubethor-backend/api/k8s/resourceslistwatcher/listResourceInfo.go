@@ -0,0 +1,47 @@
+package resourceslistwatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Custom struct to hold information of any resource served by the dynamic client
+type ResourceInfo struct {
+	Name       string            `json:"name"`
+	Namespace  string            `json:"namespace"`
+	Kind       string            `json:"kind"`
+	ApiVersion string            `json:"apiVersion"`
+	Age        string            `json:"age"`
+	Labels     map[string]string `json:"labels"`
+	EventType  string            `json:"eventType"`
+}
+
+// Process a Kubernetes event for a resource without a typed fast path and send data to the WebSocket client
+func ListResourceInfo(data *unstructured.Unstructured, eventType string) ([]byte, error) {
+	// Calculate the age of the Resource
+	age := time.Since(data.GetCreationTimestamp().Time).String()
+
+	// Create a ResourceInfo struct with the relevant data
+	dataInfo := ResourceInfo{
+		Name:       data.GetName(),
+		Namespace:  data.GetNamespace(),
+		Kind:       data.GetKind(),
+		ApiVersion: data.GetAPIVersion(),
+		Age:        age,
+		Labels:     data.GetLabels(),
+		EventType:  eventType,
+	}
+
+	// Marshal the ResourceInfo struct into JSON
+	dataJSON, err := json.Marshal(dataInfo)
+	if err != nil {
+		// Handle the error (e.g., log or close the connection)
+		fmt.Println("Error marshaling Resource Info to JSON:", err)
+		return nil, err
+	}
+
+	return dataJSON, nil
+}
@@ -3,20 +3,20 @@ package resourceslistwatcher
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 
+	k8sclient "kubethor-backend/api"
 	config "kubethor-backend/config"
 
-	"time"
-
 	"github.com/gorilla/mux"
-	"github.com/gorilla/websocket"
 	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
@@ -24,6 +24,22 @@ func processEvent(event watch.Event, resourceType string) ([]byte, error) {
 	var respJSON []byte
 	var err error
 
+	// Watch status messages are the same for every resource type
+	switch event.Type {
+	case Synced, Resumed, Lagging:
+		resourceVersion := ""
+		if objectMeta, err := meta.Accessor(event.Object); err == nil {
+			resourceVersion = objectMeta.GetResourceVersion()
+		}
+		return json.Marshal(WatchStatusMessage{EventType: string(event.Type), ResourceVersion: resourceVersion})
+	case watch.Error:
+		errMsg := ErrorMessage{Error: fmt.Sprintf("Resource: %s - watch interrupted", resourceType)}
+		if status, ok := event.Object.(*metav1.Status); ok {
+			errMsg.K8sError = status.Message
+		}
+		return json.Marshal(errMsg)
+	}
+
 	switch resourceType {
 	case "Pod":
 		podData, ok := event.Object.(*corev1.Pod)
@@ -109,9 +125,13 @@ func processEvent(event watch.Event, resourceType string) ([]byte, error) {
 			return nil, fmt.Errorf("invalid Events event")
 		}
 		respJSON, err = ListEventInfo(eventData, string(event.Type))
-
 	default:
-		return nil, fmt.Errorf("unsupported resource type")
+		// Kinds without a typed fast path arrive from the dynamic client
+		resourceData, ok := event.Object.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("unsupported resource type")
+		}
+		respJSON, err = ListResourceInfo(resourceData, string(event.Type))
 	}
 
 	if err != nil {
@@ -139,6 +159,27 @@ func ListResources(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Optional labelSelector and fieldSelector query parameters, applied server-side
+	selector, err := k8sclient.GetResourceSelector(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Optional batchInterval and batchSize query parameters, events are then sent as JSON array frames
+	batch, err := GetBatchOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Optional delta query parameter, MODIFIED events are then sent as patches against the last summary
+	delta, err := GetDeltaMode(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Get the remote machine's IP address and check for an existing WebSocket connection
 	// ip, err := getCheckClientIPAddress(w, r)
 	// if err != nil {
@@ -156,12 +197,23 @@ func ListResources(w http.ResponseWriter, r *http.Request) {
 		// fmt.Println("Websocket Conn Closed")
 	}()
 
-	// Indicate WebSocket connection is established
-	// fmt.Println("WebSocket Connection Established")
+	// Every message goes through the connection's send queue, which also keeps it alive with pings
+	queue := newSendQueue(conn)
+	defer queue.Close()
 
 	// Start watching resources and send updates to the client
 	stopCh := make(chan struct{})
-	eventsCh, err := K8sWatchResources(sessionID, namespaceName, resourceType, stopCh)
+	forwarder := &watchForwarder{
+		queue:        queue,
+		sessionID:    sessionID,
+		namespace:    namespaceName,
+		resourceType: resourceType,
+		selector:     selector,
+		batch:        batch,
+		delta:        delta,
+		frame:        func(data []byte) []byte { return data },
+	}
+	doneCh, err := forwarder.Start(stopCh)
 	if err != nil {
 		errMsg := ErrorMessage{Error: fmt.Sprintf("Resource: %s for Namspace: %s - %s", resourceType, namespaceName, err)}
 		errMsgJSON, errJ := json.Marshal(errMsg)
@@ -169,85 +221,20 @@ func ListResources(w http.ResponseWriter, r *http.Request) {
 			// Handle the error when marshaling the JSON.
 			return
 		}
-		// fmt.Println(errMsgJSON)
-		time.Sleep(100 * time.Millisecond)
-		conn.WriteMessage(websocket.TextMessage, []byte(errMsgJSON))
+		queue.Send(errMsgJSON)
 		return
 	}
-	// defer close(stopCh) // Stop the watcher when the client disconnects // Not using this because it is slow after websocket closed
-
-	// Store the WebSocket connection for this machine
-	// machineConnections[ip] = conn
 
 	// Handle WebSocket disconnection
 	go func() {
 		_, _, err := conn.ReadMessage()
 		if err != nil {
-			// WebSocket disconnected, stop the watcher
+			// WebSocket disconnected, stop the watcher and drop whatever is still queued
+			queue.Abort(err)
 			close(stopCh)
 		}
 	}()
 
-	// Ping-Pong to keep the connection alive
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-					close(stopCh)
-					return
-				}
-			case <-stopCh:
-				return
-			}
-		}
-	}()
-
-	// Send updates to the client
-	for event := range eventsCh {
-		var respJSON []byte
-
-		if event.Type == watch.Error {
-			// Handle error event, if needed
-			errMsg := ErrorMessage{
-				Error: "K8s Watcher Pod Event Error Occurred",
-			}
-			// Convert the error message to JSON
-			respJSON, _ = json.Marshal(errMsg)
-		} else if event.Type != "" && event.Object != nil {
-			// Check if the event has a non-empty type and a non-nil object - watch.Event{Type:"", Object:runtime.Object(nil)}
-			// You can send the event data to the client using conn.WriteMessage or a similar method.
-			// Make sure to handle different types of events (e.g., Added, Modified, Deleted) as needed.
-			// Convert Resource Data to JSON
-			respJSON, err = processEvent(event, resourceType)
-			if err != nil {
-				// Handle the error (e.g., log or close the connection)
-				log.Println("Error processing event:", err)
-				continue
-			}
-		}
-
-		// Send the JSON data to the client only if respJSON is not empty
-		if len(respJSON) > 0 {
-			// Send the JSON data to the client
-			err = conn.WriteMessage(websocket.TextMessage, respJSON)
-			if err != nil {
-				// Error occurred while sending data, handle it (e.g., log or close the connection)
-				// log.Println("Error sending JSON data to machine:", err)
-				break
-			}
-			// The time.Sleep(100 * time.Millisecond) is used in the code to introduce a small delay between sending log messages over the WebSocket. The purpose of this sleep is to control the rate at which log messages are sent.
-			// In some scenarios, especially when dealing with high log volumes or rapid log generation, sending log messages too quickly over the WebSocket can overwhelm the receiving end, such as a web browser or WebSocket client, causing performance issues or making it challenging to process the logs in real-time.
-			time.Sleep(100 * time.Millisecond)
-		}
-	}
-
-	// WebSocket disconnected, stop the watcher (if not already stopped)
-	// fmt.Println("WebSocket disconnected for machine:")
-
-	// Remove the WebSocket connection when it's closed
-	// delete(machineConnections, ip)
+	// Wait until the client disconnects or the watcher ends
+	<-doneCh
 }
@@ -0,0 +1,249 @@
+package resourceslistwatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Log levels from the least to the most severe
+var logLevels = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+// logLevelAliases maps the level names used by common loggers to the levels above
+var logLevelAliases = map[string]string{
+	"trace":    "trace",
+	"debug":    "debug",
+	"dbg":      "debug",
+	"info":     "info",
+	"inf":      "info",
+	"notice":   "info",
+	"warn":     "warn",
+	"warning":  "warn",
+	"wrn":      "warn",
+	"error":    "error",
+	"err":      "error",
+	"fatal":    "fatal",
+	"critical": "fatal",
+	"crit":     "fatal",
+	"panic":    "fatal",
+	"alert":    "fatal",
+	"emerg":    "fatal",
+}
+
+// JSON keys holding the level, message and time of a structured log line, in order of preference
+var (
+	jsonLevelKeys = []string{"level", "lvl", "severity", "loglevel"}
+	jsonMsgKeys   = []string{"msg", "message"}
+	jsonTimeKeys  = []string{"ts", "time", "timestamp", "@timestamp"}
+)
+
+// Levels of plain text lines, e.g. "level=error" from logfmt or an upper case "ERROR"
+var (
+	logfmtLevelPattern = regexp.MustCompile(`\blevel=["']?([A-Za-z]+)`)
+	textLevelPattern   = regexp.MustCompile(`\b(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|FATAL|CRITICAL|PANIC)\b`)
+)
+
+// LogFilterOptions are the filter query parameters of the log streams, and the filter options of a stream subscription.
+type LogFilterOptions struct {
+	Include  string `json:"include,omitempty"`
+	Exclude  string `json:"exclude,omitempty"`
+	MinLevel string `json:"minLevel,omitempty"`
+	Parse    string `json:"parse,omitempty"`
+}
+
+// GetLogFilterOptions reads the include, exclude, minLevel and parse query parameters,
+// e.g. ?exclude=healthz&minLevel=warn&parse=json
+func GetLogFilterOptions(r *http.Request) LogFilterOptions {
+	query := r.URL.Query()
+	return LogFilterOptions{
+		Include:  query.Get("include"),
+		Exclude:  query.Get("exclude"),
+		MinLevel: query.Get("minLevel"),
+		Parse:    query.Get("parse"),
+	}
+}
+
+// LogFilter drops the log lines the client isn't interested in before they are sent, and parses JSON lines.
+// A nil filter keeps every line as is.
+type LogFilter struct {
+	include   *regexp.Regexp
+	exclude   *regexp.Regexp
+	minLevel  int
+	parseJSON bool
+}
+
+// LogFilter validates the options, it returns nil when no option is set.
+func (o LogFilterOptions) LogFilter() (*LogFilter, error) {
+	if o == (LogFilterOptions{}) {
+		return nil, nil
+	}
+
+	filter := &LogFilter{minLevel: -1}
+	var err error
+	if o.Include != "" {
+		if filter.include, err = regexp.Compile(o.Include); err != nil {
+			return nil, fmt.Errorf("invalid include: %s", err.Error())
+		}
+	}
+	if o.Exclude != "" {
+		if filter.exclude, err = regexp.Compile(o.Exclude); err != nil {
+			return nil, fmt.Errorf("invalid exclude: %s", err.Error())
+		}
+	}
+	if o.MinLevel != "" {
+		level, ok := logLevelAliases[strings.ToLower(o.MinLevel)]
+		if !ok {
+			return nil, fmt.Errorf("invalid minLevel: %s, must be one of %s", o.MinLevel, strings.Join(logLevels, ", "))
+		}
+		filter.minLevel = logLevelIndex(level)
+	}
+	switch o.Parse {
+	case "":
+	case "json":
+		filter.parseJSON = true
+	default:
+		return nil, fmt.Errorf("invalid parse: %s, must be json", o.Parse)
+	}
+
+	return filter, nil
+}
+
+// Keep reports whether the line is sent. It sets the level, message and time of the line when they are parsed.
+// Lines without a recognizable level pass the minimum level.
+func (f *LogFilter) Keep(line *logLine) bool {
+	if f == nil {
+		return true
+	}
+
+	if f.include != nil && !f.include.MatchString(line.Log) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(line.Log) {
+		return false
+	}
+
+	if f.parseJSON {
+		parseJSONLogLine(line)
+	}
+	if line.Level == "" && (f.parseJSON || f.minLevel >= 0) {
+		line.Level = detectLogLevel(line.Log)
+	}
+
+	if f.minLevel >= 0 && line.Level != "" && logLevelIndex(line.Level) < f.minLevel {
+		return false
+	}
+	return true
+}
+
+func logLevelIndex(level string) int {
+	for i, name := range logLevels {
+		if name == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// normalizeLogLevel maps a level name, or a pino/bunyan numeric level, to one of logLevels
+func normalizeLogLevel(value interface{}) string {
+	switch level := value.(type) {
+	case string:
+		return logLevelAliases[strings.ToLower(level)]
+	case float64:
+		// 10 trace, 20 debug, 30 info, 40 warn, 50 error, 60 fatal
+		index := int(level)/10 - 1
+		if index < 0 || index >= len(logLevels) {
+			return ""
+		}
+		return logLevels[index]
+	}
+	return ""
+}
+
+// detectLogLevel finds the level of a plain text line
+func detectLogLevel(text string) string {
+	if match := logfmtLevelPattern.FindStringSubmatch(text); match != nil {
+		if level := normalizeLogLevel(match[1]); level != "" {
+			return level
+		}
+	}
+	if match := textLevelPattern.FindString(text); match != "" {
+		return normalizeLogLevel(match)
+	}
+	return ""
+}
+
+// parseJSONLogLine sets the level, message and time of a line that is a JSON object
+func parseJSONLogLine(line *logLine) {
+	text := strings.TrimSpace(line.Log)
+	if line.Partial || !strings.HasPrefix(text, "{") {
+		return
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &fields); err != nil {
+		return
+	}
+
+	if value, ok := firstJSONField(fields, jsonLevelKeys); ok {
+		line.Level = normalizeLogLevel(value)
+	}
+	if value, ok := firstJSONField(fields, jsonMsgKeys); ok {
+		if msg, ok := value.(string); ok {
+			line.Msg = msg
+		}
+	}
+	if value, ok := firstJSONField(fields, jsonTimeKeys); ok {
+		line.Ts = formatJSONLogTime(value)
+	}
+}
+
+func firstJSONField(fields map[string]interface{}, keys []string) (interface{}, bool) {
+	for _, key := range keys {
+		if value, ok := fields[key]; ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// formatJSONLogTime keeps a textual time as is and converts a Unix time in seconds or milliseconds to RFC3339
+func formatJSONLogTime(value interface{}) string {
+	switch ts := value.(type) {
+	case string:
+		return ts
+	case float64:
+		// Times after 2001 in milliseconds exceed 1e12, in seconds they don't
+		if ts > 1e12 {
+			return time.UnixMilli(int64(ts)).UTC().Format(time.RFC3339Nano)
+		}
+		// A float64 holds about microseconds for current times, the rest is rounding noise
+		seconds, fraction := math.Modf(ts)
+		return time.Unix(int64(seconds), int64(math.Round(fraction*1e6))*1e3).UTC().Format(time.RFC3339Nano)
+	}
+	return ""
+}
+
+// logLineFilter applies a filter to the lines of one log stream. The pieces of a line longer than the
+// maximum are kept or dropped together, as decided on the first one.
+type logLineFilter struct {
+	filter    *LogFilter
+	continued bool
+	keep      bool
+	level     string
+}
+
+func (l *logLineFilter) Keep(line *logLine) bool {
+	if l.continued {
+		line.Level = l.level
+	} else {
+		l.keep = l.filter.Keep(line)
+		l.level = line.Level
+	}
+	l.continued = line.Partial
+	return l.keep
+}
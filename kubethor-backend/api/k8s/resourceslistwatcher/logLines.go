@@ -0,0 +1,102 @@
+package resourceslistwatcher
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Longer lines are sent as several partial messages
+const maxLogLineLength = 16 * 1024
+
+// logLine is a line of a container log, or a piece of one when it is longer than maxLogLineLength.
+// Level, Msg and Ts are set by a LogFilter when it parses the line.
+type logLine struct {
+	Timestamp string
+	Log       string
+	Partial   bool
+	Level     string
+	Msg       string
+	Ts        string
+}
+
+// logLineReader splits a log stream into lines. When it was requested with timestamps, the timestamp the kubelet
+// prefixed to every line is taken off it, unless the client asked to keep it in the text.
+type logLineReader struct {
+	reader         *bufio.Reader
+	timestamped    bool
+	keepTimestamps bool
+	carry          []byte
+	timestamp      string
+	continued      bool
+	err            error
+}
+
+func newLogLineReader(reader io.Reader, timestamped, keepTimestamps bool) *logLineReader {
+	return &logLineReader{
+		reader:         bufio.NewReaderSize(reader, maxLogLineLength),
+		timestamped:    timestamped,
+		keepTimestamps: keepTimestamps,
+	}
+}
+
+// Next returns the next line without its line break, or io.EOF once the stream ended
+func (l *logLineReader) Next() (logLine, error) {
+	if l.err != nil {
+		return logLine{}, l.err
+	}
+
+	chunk, err := l.reader.ReadSlice('\n')
+	// The chunk is only valid until the next read, keep a copy
+	data := append(l.carry, chunk...)
+	l.carry = nil
+
+	partial := errors.Is(err, bufio.ErrBufferFull)
+	if err != nil && !partial {
+		// A last line without a line break is still a line
+		l.err = err
+		if len(data) == 0 {
+			return logLine{}, err
+		}
+	}
+
+	if partial {
+		// Don't split a UTF-8 sequence, its start goes with the next piece
+		complete := len(data) - incompleteRuneSuffix(data)
+		l.carry = append([]byte(nil), data[complete:]...)
+		data = data[:complete]
+	}
+
+	text := string(data)
+	if !partial {
+		text = strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")
+	}
+
+	// Only the first piece of a line carries its timestamp, without one the time the line was read is used
+	if !l.continued {
+		if l.timestamped {
+			l.timestamp, text = splitLogTimestamp(text, l.keepTimestamps)
+		} else {
+			l.timestamp = time.Now().Format(time.RFC3339Nano)
+		}
+	}
+	l.continued = partial
+
+	return logLine{Timestamp: l.timestamp, Log: text, Partial: partial}, nil
+}
+
+// splitLogTimestamp parses the RFC3339 timestamp the kubelet prefixes to a line. Without one,
+// the time the line was read is used.
+func splitLogTimestamp(text string, keepTimestamp bool) (string, string) {
+	if i := strings.IndexByte(text, ' '); i > 0 {
+		if timestamp, err := time.Parse(time.RFC3339Nano, text[:i]); err == nil {
+			if !keepTimestamp {
+				text = text[i+1:]
+			}
+			return timestamp.Format(time.RFC3339Nano), text
+		}
+	}
+	return time.Now().Format(time.RFC3339Nano), text
+}
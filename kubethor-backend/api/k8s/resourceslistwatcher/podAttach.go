@@ -0,0 +1,126 @@
+package resourceslistwatcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	k8sclient "kubethor-backend/api"
+	config "kubethor-backend/config"
+
+	"github.com/gorilla/mux"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// PodAttach attaches to the main process of a running container, like kubectl attach -it.
+// It uses the same frames as the exec terminal.
+func PodAttach(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	namespace := vars["namespace_name"]
+	podName := vars["pod_name"]
+	containerName := vars["container_name"]
+
+	// Retrieve user data using session ID
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := config.WebSocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		http.Error(w, "Could not upgrade connection to WebSocket", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	session := newTerminalSession(conn)
+	defer session.Close()
+
+	// Detach once the client disconnects, the process keeps running
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-session.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err = K8sPodAttach(ctx, userData, namespace, podName, containerName, session.AttachStreamOptions)
+	session.SendExit(err)
+}
+
+// K8sPodAttach attaches to the main process of the container until it exits or the context is canceled.
+// The streams are built from the container spec: a TTY only if it has tty: true, stdin only if it has stdin: true.
+func K8sPodAttach(ctx context.Context, userData *k8sclient.UserData, namespace, podName, containerName string, streamOptionsFor func(stdin, tty bool) remotecommand.StreamOptions) error {
+	// Check if clientset is properly initialized
+	if userData.Clientset == nil || userData.RestConfig == nil {
+		return fmt.Errorf("clientset is nil, clientset not properly initialized")
+	}
+
+	pod, err := userData.Clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return fmt.Errorf("cannot attach to a container in a completed pod; current phase is %s", pod.Status.Phase)
+	}
+
+	stdin, tty, found := containerStreams(pod, containerName)
+	if !found {
+		return fmt.Errorf("container %s not found in pod %s", containerName, podName)
+	}
+
+	streamOptions := streamOptionsFor(stdin, tty)
+	if !stdin {
+		streamOptions.Stdin = nil
+	}
+
+	req := userData.Clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("attach").
+		VersionedParams(&corev1.PodAttachOptions{
+			Container: containerName,
+			Stdin:     streamOptions.Stdin != nil,
+			Stdout:    streamOptions.Stdout != nil,
+			Stderr:    streamOptions.Stderr != nil,
+			TTY:       streamOptions.Tty,
+		}, scheme.ParameterCodec)
+
+	executor, err := k8sclient.NewRemoteExecutor(userData.RestConfig, req.URL())
+	if err != nil {
+		return err
+	}
+
+	return executor.StreamWithContext(ctx, streamOptions)
+}
+
+// containerStreams returns whether the container keeps stdin open and allocates a TTY, init and ephemeral containers included
+func containerStreams(pod *corev1.Pod, containerName string) (stdin bool, tty bool, found bool) {
+	for _, containers := range [][]corev1.Container{pod.Spec.Containers, pod.Spec.InitContainers} {
+		for _, container := range containers {
+			if container.Name == containerName {
+				return container.Stdin, container.TTY, true
+			}
+		}
+	}
+	for _, container := range pod.Spec.EphemeralContainers {
+		if container.Name == containerName {
+			return container.Stdin, container.TTY, true
+		}
+	}
+	return false, false, false
+}
@@ -0,0 +1,81 @@
+package resourceslistwatcher
+
+import (
+	"context"
+	"net/http"
+
+	k8sclient "kubethor-backend/api"
+	"kubethor-backend/api/k8s/resources"
+	config "kubethor-backend/config"
+
+	"github.com/gorilla/mux"
+)
+
+// PodDebug adds an ephemeral debug container to a pod and attaches to it once it runs, like kubectl debug -it.
+// It uses the same frames as the exec terminal, preceded by a container frame with the debug container name.
+func PodDebug(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	namespace := vars["namespace_name"]
+	podName := vars["pod_name"]
+
+	// Retrieve user data using session ID
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	request := resources.DebugContainerRequest{
+		Image:           r.URL.Query().Get("image"),
+		Name:            r.URL.Query().Get("name"),
+		TargetContainer: r.URL.Query().Get("target"),
+		Command:         r.URL.Query()["command"],
+	}
+	if request.Image == "" {
+		http.Error(w, "image must be provided", http.StatusBadRequest)
+		return
+	}
+
+	conn, err := config.WebSocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		http.Error(w, "Could not upgrade connection to WebSocket", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	session := newTerminalSession(conn)
+	defer session.Close()
+
+	// Stop waiting or detach once the client disconnects, the debug container keeps running
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-session.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	debugContainer, err := resources.K8sCreateDebugContainer(ctx, sessionID, namespace, podName, request)
+	if err != nil {
+		session.SendExit(err)
+		return
+	}
+	// The client can reattach with the name after a disconnect
+	session.sendMessage(TerminalMessage{Type: "container", Data: debugContainer.Name})
+
+	if err := resources.K8sWaitForEphemeralContainer(ctx, sessionID, namespace, podName, debugContainer.Name); err != nil {
+		session.SendExit(err)
+		return
+	}
+
+	err = K8sPodAttach(ctx, userData, namespace, podName, debugContainer.Name, session.AttachStreamOptions)
+	session.SendExit(err)
+}
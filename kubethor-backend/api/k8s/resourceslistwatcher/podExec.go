@@ -0,0 +1,67 @@
+package resourceslistwatcher
+
+import (
+	"context"
+	"net/http"
+
+	k8sclient "kubethor-backend/api"
+	config "kubethor-backend/config"
+
+	"github.com/gorilla/mux"
+)
+
+// Command run by the exec terminal when none is given
+var defaultExecCommand = []string{"/bin/sh"}
+
+// PodExec opens an interactive terminal in a container, like kubectl exec -it.
+func PodExec(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	namespace := vars["namespace_name"]
+	podName := vars["pod_name"]
+	containerName := vars["container_name"]
+
+	// Retrieve user data using session ID
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Optional command query parameters, one per argument, e.g. ?command=/bin/bash&command=-l
+	command := r.URL.Query()["command"]
+	if len(command) == 0 {
+		command = defaultExecCommand
+	}
+	// Optional tty query parameter, stderr is merged into stdout while a TTY is allocated
+	tty := r.URL.Query().Get("tty") != "false"
+
+	conn, err := config.WebSocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		http.Error(w, "Could not upgrade connection to WebSocket", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	session := newTerminalSession(conn)
+	defer session.Close()
+
+	// Stop the command stream once the client disconnects
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-session.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err = k8sclient.StreamPodExec(ctx, userData, namespace, podName, containerName, command, session.StreamOptions(tty))
+	session.SendExit(err)
+}
@@ -2,22 +2,42 @@ package resourceslistwatcher
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
 	k8sclient "kubethor-backend/api"
+	"kubethor-backend/api/k8s/resources"
 	config "kubethor-backend/config"
-	"time"
 
 	"encoding/json"
 
 	"github.com/gorilla/mux"
-	"github.com/gorilla/websocket"
 	corev1 "k8s.io/api/core/v1"
 )
 
+// LogMessage is a line of a container log. Seq numbers the messages of a stream from 1, so a client can
+// detect a gap. A line longer than the maximum is split into messages with partial set on all but the last.
+// Level, Msg and Ts are the fields parsed from a JSON line, or the level detected in a plain text line.
 type LogMessage struct {
+	Seq       uint64 `json:"seq"`
 	Timestamp string `json:"timestamp"`
 	Log       string `json:"log"`
+	Partial   bool   `json:"partial,omitempty"`
+	Level     string `json:"level,omitempty"`
+	Msg       string `json:"msg,omitempty"`
+	Ts        string `json:"ts,omitempty"`
+}
+
+func newLogMessage(seq uint64, line logLine) *LogMessage {
+	return &LogMessage{
+		Seq:       seq,
+		Timestamp: line.Timestamp,
+		Log:       line.Log,
+		Partial:   line.Partial,
+		Level:     line.Level,
+		Msg:       line.Msg,
+		Ts:        line.Ts,
+	}
 }
 
 func WatchPodLogs(w http.ResponseWriter, r *http.Request) {
@@ -35,6 +55,29 @@ func WatchPodLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	vars := mux.Vars(r)
+	namespace := vars["namespace_name"]
+	podName := vars["pod_name"]
+	containerName := vars["container_name"]
+
+	// Optional previous, tailLines, sinceSeconds, sinceTime, timestamps and limitBytes query parameters
+	options, err := resources.GetLogOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logOptions, err := options.PodLogOptions(containerName, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Optional include, exclude, minLevel and parse query parameters
+	filter, err := GetLogFilterOptions(r).LogFilter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Upgrade the HTTP connection to a WebSocket connection.
 	conn, err := config.WebSocketUpgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -46,20 +89,6 @@ func WatchPodLogs(w http.ResponseWriter, r *http.Request) {
 		// log.Println("Defer WS Conn Closed")
 	}()
 
-	vars := mux.Vars(r)
-	namespace := vars["namespace_name"]
-	podName := vars["pod_name"]
-	containerName := vars["container_name"]
-
-	// Define log options
-	logOptions := &corev1.PodLogOptions{
-		Container: containerName,
-		Follow:    true, // Set to true to stream logs
-	}
-
-	// Create a pod log request
-	req := userData.Clientset.CoreV1().Pods(namespace).GetLogs(podName, logOptions)
-
 	// Create a context with a cancelation mechanism
 	ctx, cancel := context.WithCancel(context.Background())
 	defer func() {
@@ -67,81 +96,86 @@ func WatchPodLogs(w http.ResponseWriter, r *http.Request) {
 		// log.Println("Context canceled")
 	}()
 
-	// Stream pod logs and send them over WebSocket
-	podLog, err := req.Stream(ctx)
-	if err != nil {
-		// log.Printf("Error streaming pod logs: %v", err)
-		return
-	}
-	defer podLog.Close()
-
-	// Create a channel to signal the closure of the WebSocket connection
-	stopCh := make(chan struct{})
+	// Every message goes through the connection's send queue, which also keeps it alive with pings
+	queue := newSendQueue(conn)
+	defer queue.Close()
 
 	// Start a goroutine to check the WebSocket status
 	go func() {
 		for {
 			_, _, err := conn.ReadMessage()
 			if err != nil {
-				conn.Close()
 				// log.Printf("WebSocket connection closed by the client: %v", err)
-				podLog.Close() // Close the pod log stream
-				// log.Println("WebSocket closed by client")
-				cancel()
+				queue.Abort(err)
+				cancel() // Close the pod log stream
 				// log.Println("Pod Log Stream closed")
-				close(stopCh)
 				return
 			}
 		}
 	}()
 
-	// Ping-Pong to keep the connection alive
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+	// Stream pod logs and send them over WebSocket, reading pauses while the client is behind
+	err = K8sStreamPodLogs(ctx, userData, namespace, podName, logOptions, filter, queue.Send)
+	// Tell the client why there are no logs, e.g. the container has no previous instance
+	if err != nil && ctx.Err() == nil {
+		errMsg, _ := json.Marshal(ErrorMessage{Error: fmt.Sprintf("Pod: %s logs", podName), K8sError: err.Error()})
+		queue.Send(errMsg)
+	}
+}
 
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-					close(stopCh)
-					return
-				}
-			case <-stopCh:
-				return
-			}
-		}
-	}()
+// K8sStreamPodLogs reads the logs of a container and hands every line the filter keeps as a JSON LogMessage to send,
+// until the context is canceled, the stream ends or send fails. A blocking send slows down the reading.
+func K8sStreamPodLogs(ctx context.Context, userData *k8sclient.UserData, namespace, podName string, logOptions *corev1.PodLogOptions, filter *LogFilter, send func(jsonData []byte) error) error {
+	var seq uint64
+	return k8sStreamPodLogLines(ctx, userData, namespace, podName, logOptions, filter, func(line logLine) error {
+		// Create a LogMessage and populate it with data, dropped lines don't take a sequence number
+		seq++
+		logMessage := newLogMessage(seq, line)
 
-	for {
-		buf := make([]byte, 1024)
-		n, err := podLog.Read(buf)
+		// Marshal the LogMessage struct into JSON
+		jsonData, err := json.Marshal(logMessage)
 		if err != nil {
-			// log.Printf("Error reading pod logs: %v", err)
-			break
+			// log.Printf("Error marshaling log message to JSON: %v", err)
+			return err
 		}
 
-		// Create a LogMessage struct and populate it with data
-		logMessage := LogMessage{
-			Timestamp: time.Now().Format(time.RFC3339),
-			Log:       string(buf[:n]),
-		}
+		// Send the JSON-encoded log message
+		return send(jsonData)
+	})
+}
 
-		// Marshal the LogMessage struct into JSON
-		jsonData, err := json.Marshal(logMessage)
+// k8sStreamPodLogLines reads the logs of a container and hands every line the filter keeps to send, until the context
+// is canceled, the stream ends or send fails.
+func k8sStreamPodLogLines(ctx context.Context, userData *k8sclient.UserData, namespace, podName string, logOptions *corev1.PodLogOptions, filter *LogFilter, send func(line logLine) error) error {
+	// Ask the kubelet for timestamps, they are moved out of the line unless the client wants them kept.
+	// The kubelet counts them towards limitBytes though, so a limited log only has them if the client asked.
+	keepTimestamps := logOptions.Timestamps
+	timestampedOptions := *logOptions
+	timestampedOptions.Timestamps = keepTimestamps || logOptions.LimitBytes == nil
+
+	// Stream pod logs
+	podLog, err := resources.K8sOpenPodLogs(ctx, userData, namespace, podName, &timestampedOptions)
+	if err != nil {
+		// log.Printf("Error streaming pod logs: %v", err)
+		return err
+	}
+	defer podLog.Close()
+
+	lines := newLogLineReader(podLog, timestampedOptions.Timestamps, keepTimestamps)
+	lineFilter := &logLineFilter{filter: filter}
+	for {
+		line, err := lines.Next()
 		if err != nil {
-			// log.Printf("Error marshaling log message to JSON: %v", err)
-			break
+			// log.Printf("Error reading pod logs: %v", err)
+			return nil
+		}
+		if !lineFilter.Keep(&line) {
+			continue
 		}
 
-		// Send the JSON-encoded log message over WebSocket
-		if err := conn.WriteMessage(websocket.TextMessage, jsonData); err != nil {
+		if err := send(line); err != nil {
 			// log.Printf("Error sending log message over WebSocket: %v", err)
-			break
+			return err
 		}
-
-		// The time.Sleep(100 * time.Millisecond) is used in the code to introduce a small delay between sending log messages over the WebSocket. The purpose of this sleep is to control the rate at which log messages are sent.
-		// In some scenarios, especially when dealing with high log volumes or rapid log generation, sending log messages too quickly over the WebSocket can overwhelm the receiving end, such as a web browser or WebSocket client, causing performance issues or making it challenging to process the logs in real-time.
-		time.Sleep(100 * time.Millisecond)
 	}
 }
@@ -0,0 +1,83 @@
+package resourceslistwatcher
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kubethor-backend/api/k8s/resources"
+	config "kubethor-backend/config"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// PortForwardTunnel tunnels raw TCP to a pod port over a WebSocket, every binary frame carries a chunk of the stream.
+// It shares the session's port-forward with the HTTP reverse proxy.
+func PortForwardTunnel(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	namespace := vars["namespace_name"]
+	podName := vars["pod_name"]
+	port, err := strconv.Atoi(vars["port"])
+	if err != nil || namespace == "" || podName == "" {
+		http.Error(w, "namespace, pod name & port must be provided", http.StatusBadRequest)
+		return
+	}
+
+	forward, err := resources.K8sPortForward(sessionID, namespace, podName, port)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error forwarding Pod: %s port %d: %s", podName, port, err.Error()), http.StatusBadGateway)
+		return
+	}
+
+	tcpConn, err := net.Dial("tcp", forward.LocalAddress())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Pod: %s port %d: %s", podName, port, err.Error()), http.StatusBadGateway)
+		return
+	}
+	defer tcpConn.Close()
+
+	conn, err := config.WebSocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		http.Error(w, "Could not upgrade connection to WebSocket", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	// Pod to client, the close frame tells the client the pod side closed the connection
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := tcpConn.Read(buf)
+			if n > 0 {
+				conn.SetWriteDeadline(time.Now().Add(writeWait))
+				if writeErr := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); writeErr != nil {
+					return
+				}
+			}
+			if err != nil {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "connection closed by pod"), time.Now().Add(writeWait))
+				return
+			}
+		}
+	}()
+
+	// Client to pod, until the client disconnects
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if _, err := tcpConn.Write(data); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package resourceslistwatcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	k8sclient "kubethor-backend/api"
+	"kubethor-backend/api/k8s/resources"
+	config "kubethor-backend/config"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// How long a rollout is followed when the client sets no timeout
+const defaultRolloutStatusTimeout = 10 * time.Minute
+
+// RolloutCondition is a condition of a Deployment, StatefulSet or DaemonSet.
+type RolloutCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// RolloutStatusMessage is a progress frame of a rollout. Done is set once the rollout completed, Failed when it
+// exceeded its progress deadline, can't be followed or timed out. Either one is the last frame.
+type RolloutStatusMessage struct {
+	Namespace          string             `json:"namespace"`
+	Kind               string             `json:"kind"`
+	Name               string             `json:"name"`
+	Generation         int64              `json:"generation"`
+	ObservedGeneration int64              `json:"observedGeneration"`
+	Replicas           int32              `json:"replicas"`
+	UpdatedReplicas    int32              `json:"updatedReplicas"`
+	ReadyReplicas      int32              `json:"readyReplicas"`
+	AvailableReplicas  int32              `json:"availableReplicas"`
+	Conditions         []RolloutCondition `json:"conditions,omitempty"`
+	Message            string             `json:"message"`
+	Done               bool               `json:"done"`
+	Failed             bool               `json:"failed"`
+}
+
+// WatchRolloutStatus follows the rollout of a Deployment, StatefulSet or DaemonSet like kubectl rollout status.
+// A frame is sent whenever the progress changes, until the rollout completes, fails or the timeout passes.
+func WatchRolloutStatus(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	namespace := vars["namespace_name"]
+	name := vars["resource_name"]
+	kind, err := resources.RolloutKind(vars["resource_type"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if namespace == k8sclient.AllNamespaces {
+		http.Error(w, "a rollout can't be followed across all namespaces", http.StatusBadRequest)
+		return
+	}
+
+	// Optional timeout query parameter, e.g. ?timeout=5m, 0 follows the rollout until it ends
+	timeout := defaultRolloutStatusTimeout
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		if timeout, err = time.ParseDuration(value); err != nil || timeout < 0 {
+			http.Error(w, fmt.Sprintf("invalid timeout: %s", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	conn, err := config.WebSocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	queue := newSendQueue(conn)
+	defer queue.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Stop following once the client disconnects
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				queue.Abort(err)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	sendError := func(errMsg ErrorMessage) {
+		errJSON, _ := json.Marshal(errMsg)
+		queue.Send(errJSON)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	selector := k8sclient.ResourceSelector{FieldSelector: "metadata.name=" + name}
+	eventsCh, err := K8sWatchResources(sessionID, namespace, kind, selector, stopCh)
+	if err != nil {
+		sendError(ErrorMessage{Error: fmt.Sprintf("%s: %s rollout status", kind, name), K8sError: err.Error()})
+		return
+	}
+
+	var last *RolloutStatusMessage
+	var lastJSON []byte
+	send := func(status *RolloutStatusMessage) {
+		statusJSON, err := json.Marshal(status)
+		if err != nil || bytes.Equal(statusJSON, lastJSON) {
+			return
+		}
+		last, lastJSON = status, statusJSON
+		queue.Send(statusJSON)
+	}
+	closeNormally := func(reason string) {
+		// Let the queued frames go out before the close frame, its reason is limited to 123 bytes
+		queue.Close()
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason), time.Now().Add(writeWait))
+	}
+
+	for {
+		select {
+		case event, ok := <-eventsCh:
+			if !ok {
+				return
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				status, err := rolloutStatus(kind, event.Object)
+				if err != nil {
+					sendError(ErrorMessage{Error: fmt.Sprintf("%s: %s rollout status", kind, name), K8sError: err.Error()})
+					return
+				}
+				send(status)
+				if status.Done {
+					closeNormally("rollout complete")
+					return
+				}
+				if status.Failed {
+					closeNormally("rollout failed")
+					return
+				}
+			case Synced:
+				// The initial list is complete, the resource doesn't exist
+				if last == nil {
+					sendError(ErrorMessage{Error: fmt.Sprintf("%s: %s rollout status - %s not found", kind, name, kind)})
+					return
+				}
+			case watch.Deleted:
+				sendError(ErrorMessage{Error: fmt.Sprintf("%s: %s rollout status - %s was deleted", kind, name, kind)})
+				return
+			case watch.Error:
+				errMsg := ErrorMessage{Error: fmt.Sprintf("%s: %s rollout status - watch interrupted", kind, name)}
+				if status, ok := event.Object.(*metav1.Status); ok {
+					errMsg.K8sError = status.Message
+				}
+				sendError(errMsg)
+			}
+		case <-ctx.Done():
+			if ctx.Err() != context.DeadlineExceeded {
+				return
+			}
+			if last == nil {
+				sendError(ErrorMessage{Error: fmt.Sprintf("%s: %s rollout status - timed out", kind, name)})
+				return
+			}
+			timedOut := *last
+			timedOut.Failed = true
+			timedOut.Message = fmt.Sprintf("timed out after %s waiting for the rollout: %s", timeout, last.Message)
+			send(&timedOut)
+			closeNormally("timed out")
+			return
+		}
+	}
+}
+
+// rolloutStatus evaluates the progress of a rollout with the rules kubectl rollout status uses
+func rolloutStatus(kind string, object runtime.Object) (*RolloutStatusMessage, error) {
+	switch kind {
+	case "Deployment":
+		deployment := &appsv1.Deployment{}
+		if err := toTypedObject(object, deployment); err != nil {
+			return nil, err
+		}
+		return deploymentRolloutStatus(deployment), nil
+	case "StatefulSet":
+		statefulSet := &appsv1.StatefulSet{}
+		if err := toTypedObject(object, statefulSet); err != nil {
+			return nil, err
+		}
+		return statefulSetRolloutStatus(statefulSet), nil
+	case "DaemonSet":
+		daemonSet := &appsv1.DaemonSet{}
+		if err := toTypedObject(object, daemonSet); err != nil {
+			return nil, err
+		}
+		return daemonSetRolloutStatus(daemonSet), nil
+	}
+	return nil, fmt.Errorf("unsupported kind: %s", kind)
+}
+
+// toTypedObject copies a typed informer object, or converts an unstructured one, into the typed object
+func toTypedObject(object runtime.Object, into runtime.Object) error {
+	switch source := object.(type) {
+	case *unstructured.Unstructured:
+		return runtime.DefaultUnstructuredConverter.FromUnstructured(source.UnstructuredContent(), into)
+	case *appsv1.Deployment:
+		if deployment, ok := into.(*appsv1.Deployment); ok {
+			*deployment = *source.DeepCopy()
+			return nil
+		}
+	case *appsv1.StatefulSet:
+		if statefulSet, ok := into.(*appsv1.StatefulSet); ok {
+			*statefulSet = *source.DeepCopy()
+			return nil
+		}
+	case *appsv1.DaemonSet:
+		if daemonSet, ok := into.(*appsv1.DaemonSet); ok {
+			*daemonSet = *source.DeepCopy()
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected object type %T", object)
+}
+
+func deploymentRolloutStatus(deployment *appsv1.Deployment) *RolloutStatusMessage {
+	status := &RolloutStatusMessage{
+		Namespace:          deployment.Namespace,
+		Kind:               "Deployment",
+		Name:               deployment.Name,
+		Generation:         deployment.Generation,
+		ObservedGeneration: deployment.Status.ObservedGeneration,
+		Replicas:           deployment.Status.Replicas,
+		UpdatedReplicas:    deployment.Status.UpdatedReplicas,
+		ReadyReplicas:      deployment.Status.ReadyReplicas,
+		AvailableReplicas:  deployment.Status.AvailableReplicas,
+	}
+	for _, condition := range deployment.Status.Conditions {
+		status.Conditions = append(status.Conditions, RolloutCondition{
+			Type: string(condition.Type), Status: string(condition.Status), Reason: condition.Reason, Message: condition.Message,
+		})
+	}
+
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		status.Message = "Waiting for deployment spec update to be observed"
+		return status
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			status.Message = fmt.Sprintf("deployment %q exceeded its progress deadline", deployment.Name)
+			status.Failed = true
+			return status
+		}
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	switch {
+	case deployment.Status.UpdatedReplicas < replicas:
+		status.Message = fmt.Sprintf("Waiting for deployment %q rollout to finish: %d out of %d new replicas have been updated", deployment.Name, deployment.Status.UpdatedReplicas, replicas)
+	case deployment.Status.Replicas > deployment.Status.UpdatedReplicas:
+		status.Message = fmt.Sprintf("Waiting for deployment %q rollout to finish: %d old replicas are pending termination", deployment.Name, deployment.Status.Replicas-deployment.Status.UpdatedReplicas)
+	case deployment.Status.AvailableReplicas < deployment.Status.UpdatedReplicas:
+		status.Message = fmt.Sprintf("Waiting for deployment %q rollout to finish: %d of %d updated replicas are available", deployment.Name, deployment.Status.AvailableReplicas, deployment.Status.UpdatedReplicas)
+	default:
+		status.Message = fmt.Sprintf("deployment %q successfully rolled out", deployment.Name)
+		status.Done = true
+	}
+	return status
+}
+
+func statefulSetRolloutStatus(statefulSet *appsv1.StatefulSet) *RolloutStatusMessage {
+	status := &RolloutStatusMessage{
+		Namespace:          statefulSet.Namespace,
+		Kind:               "StatefulSet",
+		Name:               statefulSet.Name,
+		Generation:         statefulSet.Generation,
+		ObservedGeneration: statefulSet.Status.ObservedGeneration,
+		Replicas:           statefulSet.Status.Replicas,
+		UpdatedReplicas:    statefulSet.Status.UpdatedReplicas,
+		ReadyReplicas:      statefulSet.Status.ReadyReplicas,
+		AvailableReplicas:  statefulSet.Status.AvailableReplicas,
+	}
+	for _, condition := range statefulSet.Status.Conditions {
+		status.Conditions = append(status.Conditions, RolloutCondition{
+			Type: string(condition.Type), Status: string(condition.Status), Reason: condition.Reason, Message: condition.Message,
+		})
+	}
+
+	if statefulSet.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		status.Message = fmt.Sprintf("rollout status is only available for %s strategy type", appsv1.RollingUpdateStatefulSetStrategyType)
+		status.Failed = true
+		return status
+	}
+	if statefulSet.Status.ObservedGeneration == 0 || statefulSet.Generation > statefulSet.Status.ObservedGeneration {
+		status.Message = "Waiting for statefulset spec update to be observed"
+		return status
+	}
+
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	if statefulSet.Status.ReadyReplicas < replicas {
+		status.Message = fmt.Sprintf("Waiting for %d pods to be ready", replicas-statefulSet.Status.ReadyReplicas)
+		return status
+	}
+
+	rollingUpdate := statefulSet.Spec.UpdateStrategy.RollingUpdate
+	if rollingUpdate != nil && rollingUpdate.Partition != nil && *rollingUpdate.Partition > 0 {
+		partitioned := replicas - *rollingUpdate.Partition
+		if statefulSet.Status.UpdatedReplicas < partitioned {
+			status.Message = fmt.Sprintf("Waiting for partitioned roll out to finish: %d out of %d new pods have been updated", statefulSet.Status.UpdatedReplicas, partitioned)
+			return status
+		}
+		status.Message = fmt.Sprintf("partitioned roll out complete: %d new pods have been updated", statefulSet.Status.UpdatedReplicas)
+		status.Done = true
+		return status
+	}
+
+	if statefulSet.Status.UpdateRevision != statefulSet.Status.CurrentRevision {
+		status.Message = fmt.Sprintf("waiting for statefulset rolling update to complete %d pods at revision %s", statefulSet.Status.UpdatedReplicas, statefulSet.Status.UpdateRevision)
+		return status
+	}
+	status.Message = fmt.Sprintf("statefulset rolling update complete %d pods at revision %s", statefulSet.Status.CurrentReplicas, statefulSet.Status.CurrentRevision)
+	status.Done = true
+	return status
+}
+
+func daemonSetRolloutStatus(daemonSet *appsv1.DaemonSet) *RolloutStatusMessage {
+	status := &RolloutStatusMessage{
+		Namespace:          daemonSet.Namespace,
+		Kind:               "DaemonSet",
+		Name:               daemonSet.Name,
+		Generation:         daemonSet.Generation,
+		ObservedGeneration: daemonSet.Status.ObservedGeneration,
+		Replicas:           daemonSet.Status.DesiredNumberScheduled,
+		UpdatedReplicas:    daemonSet.Status.UpdatedNumberScheduled,
+		ReadyReplicas:      daemonSet.Status.NumberReady,
+		AvailableReplicas:  daemonSet.Status.NumberAvailable,
+	}
+	for _, condition := range daemonSet.Status.Conditions {
+		status.Conditions = append(status.Conditions, RolloutCondition{
+			Type: string(condition.Type), Status: string(condition.Status), Reason: condition.Reason, Message: condition.Message,
+		})
+	}
+
+	if daemonSet.Spec.UpdateStrategy.Type != appsv1.RollingUpdateDaemonSetStrategyType {
+		status.Message = fmt.Sprintf("rollout status is only available for %s strategy type", appsv1.RollingUpdateDaemonSetStrategyType)
+		status.Failed = true
+		return status
+	}
+	if daemonSet.Generation > daemonSet.Status.ObservedGeneration {
+		status.Message = "Waiting for daemon set spec update to be observed"
+		return status
+	}
+
+	switch {
+	case daemonSet.Status.UpdatedNumberScheduled < daemonSet.Status.DesiredNumberScheduled:
+		status.Message = fmt.Sprintf("Waiting for daemon set %q rollout to finish: %d out of %d new pods have been updated", daemonSet.Name, daemonSet.Status.UpdatedNumberScheduled, daemonSet.Status.DesiredNumberScheduled)
+	case daemonSet.Status.NumberAvailable < daemonSet.Status.DesiredNumberScheduled:
+		status.Message = fmt.Sprintf("Waiting for daemon set %q rollout to finish: %d of %d updated pods are available", daemonSet.Name, daemonSet.Status.NumberAvailable, daemonSet.Status.DesiredNumberScheduled)
+	default:
+		status.Message = fmt.Sprintf("daemon set %q successfully rolled out", daemonSet.Name)
+		status.Done = true
+	}
+	return status
+}
@@ -0,0 +1,213 @@
+package resourceslistwatcher
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Maximum number of messages waiting to be written to a WebSocket connection
+	sendQueueSize = 1024
+	// Time allowed to write a message to the client before the connection is considered dead
+	writeWait = 10 * time.Second
+	// Interval of the pings keeping the connection alive
+	pingPeriod = 30 * time.Second
+)
+
+// sendQueue is the bounded send queue of a WebSocket connection, drained by a single writer goroutine.
+// The client is written to as fast as it reads: log streams wait for space in the queue, while resource
+// watchers never block and are told the client is lagging when the queue is full.
+type sendQueue struct {
+	conn     *websocket.Conn
+	messages []*queuedMessage
+	pending  map[string]*queuedMessage // Queued messages by coalesce key, until the writer picks them up
+	closed   bool                      // No more messages are accepted
+	aborted  bool                      // Queued messages are dropped instead of flushed
+	deadline time.Time                 // Deadline of the final flush once closed
+	err      error
+	doneCh   chan struct{}
+	mutex    sync.Mutex
+	cond     *sync.Cond
+}
+
+type queuedMessage struct {
+	key  string
+	data []byte
+}
+
+func newSendQueue(conn *websocket.Conn) *sendQueue {
+	queue := &sendQueue{
+		conn:    conn,
+		pending: make(map[string]*queuedMessage),
+		doneCh:  make(chan struct{}),
+	}
+	queue.cond = sync.NewCond(&queue.mutex)
+
+	go queue.run()
+	go queue.ping()
+
+	return queue
+}
+
+// Offer queues a message without ever blocking. A message with the same non-empty key still waiting
+// in the queue is replaced in place by the newer one. It returns false when the queue is full.
+func (q *sendQueue) Offer(key string, data []byte) bool {
+	return q.OfferFunc(key, func(coalesced bool) []byte { return data })
+}
+
+// OfferFunc is Offer with the message built under the queue lock, build is told whether the message
+// replaces one still waiting in the queue. A nil message that replaces nothing is not queued.
+func (q *sendQueue) OfferFunc(key string, build func(coalesced bool) []byte) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		// The connection is going away, there is nobody left to resync
+		return true
+	}
+
+	if key != "" {
+		if message, ok := q.pending[key]; ok {
+			message.data = build(true)
+			return true
+		}
+	}
+
+	if len(q.messages) >= sendQueueSize {
+		return false
+	}
+
+	data := build(false)
+	if data == nil {
+		return true
+	}
+
+	message := &queuedMessage{key: key, data: data}
+	q.messages = append(q.messages, message)
+	if key != "" {
+		q.pending[key] = message
+	}
+	q.cond.Broadcast()
+	return true
+}
+
+// Send queues a message, waiting for space while the queue is full.
+func (q *sendQueue) Send(data []byte) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for !q.closed && len(q.messages) >= sendQueueSize {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return q.closedErr()
+	}
+
+	q.messages = append(q.messages, &queuedMessage{data: data})
+	q.cond.Broadcast()
+	return nil
+}
+
+// WaitBelow waits until at most n messages are left in the queue.
+func (q *sendQueue) WaitBelow(n int) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for !q.closed && len(q.messages) > n {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return q.closedErr()
+	}
+	return nil
+}
+
+// Close stops accepting messages and waits until the queued ones are flushed, bounded by writeWait.
+func (q *sendQueue) Close() {
+	q.mutex.Lock()
+	if !q.closed {
+		q.closed = true
+		q.deadline = time.Now().Add(writeWait)
+		q.cond.Broadcast()
+	}
+	q.mutex.Unlock()
+
+	<-q.doneCh
+}
+
+// Abort stops the writer right away, queued messages are dropped. It is used once the connection is gone.
+func (q *sendQueue) Abort(err error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.err == nil {
+		q.err = err
+	}
+	q.closed = true
+	q.aborted = true
+	q.cond.Broadcast()
+}
+
+// closedErr must be called with the mutex held
+func (q *sendQueue) closedErr() error {
+	if q.err != nil {
+		return q.err
+	}
+	return fmt.Errorf("websocket connection closed")
+}
+
+func (q *sendQueue) run() {
+	defer close(q.doneCh)
+
+	for {
+		q.mutex.Lock()
+		for !q.closed && len(q.messages) == 0 {
+			q.cond.Wait()
+		}
+		if q.aborted || len(q.messages) == 0 {
+			q.mutex.Unlock()
+			return
+		}
+
+		// Once picked up a message can no longer be coalesced
+		message := q.messages[0]
+		q.messages[0] = nil
+		q.messages = q.messages[1:]
+		if message.key != "" {
+			delete(q.pending, message.key)
+		}
+		deadline := time.Now().Add(writeWait)
+		if q.closed {
+			deadline = q.deadline
+		}
+		q.cond.Broadcast()
+		q.mutex.Unlock()
+
+		q.conn.SetWriteDeadline(deadline)
+		if err := q.conn.WriteMessage(websocket.TextMessage, message.data); err != nil {
+			q.Abort(err)
+			return
+		}
+	}
+}
+
+// Ping-Pong to keep the connection alive, control messages may be written concurrently with the writer
+func (q *sendQueue) ping() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := q.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				q.Abort(err)
+				return
+			}
+		case <-q.doneCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package resourceslistwatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	k8sclient "kubethor-backend/api"
+	"kubethor-backend/api/k8s/resources"
+	config "kubethor-backend/config"
+)
+
+// StreamRequest is a subscribe/unsubscribe frame sent by the client on the multiplexed stream.
+// A subscription either watches a resource list or follows the logs of a container.
+type StreamRequest struct {
+	Type          string           `json:"type"` // subscribe | unsubscribe
+	ID            string           `json:"id"`
+	ResourceType  string           `json:"resourceType,omitempty"`
+	Namespace     string           `json:"namespace,omitempty"`
+	LabelSelector string           `json:"labelSelector,omitempty"`
+	FieldSelector string           `json:"fieldSelector,omitempty"`
+	BatchInterval string           `json:"batchInterval,omitempty"`
+	BatchSize     int              `json:"batchSize,omitempty"`
+	Delta         string           `json:"delta,omitempty"`
+	Log           *StreamLogTarget `json:"log,omitempty"`
+}
+
+// StreamLogTarget names the container whose logs a subscription follows, which part of them and how they are filtered.
+type StreamLogTarget struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	resources.LogOptions
+	LogFilterOptions
+}
+
+// StreamMessage is every outbound frame of the multiplexed stream, tagged with its subscription ID.
+// Data is the same JSON the dedicated resource watcher and pod logs WebSockets send.
+// Done is set on the last frame of a subscription that ended on the server side.
+type StreamMessage struct {
+	ID   string          `json:"id"`
+	Data json.RawMessage `json:"data,omitempty"`
+	Done bool            `json:"done,omitempty"`
+}
+
+// streamConn sends the frames of every subscription through the connection's send queue.
+type streamConn struct {
+	queue *sendQueue
+}
+
+// frame wraps a subscription payload into a StreamMessage
+func (c *streamConn) frame(id string, data []byte) []byte {
+	messageJSON, err := json.Marshal(StreamMessage{ID: id, Data: data})
+	if err != nil {
+		log.Println("Error marshaling stream message:", err)
+		return nil
+	}
+	return messageJSON
+}
+
+func (c *streamConn) send(message StreamMessage) error {
+	messageJSON, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return c.queue.Send(messageJSON)
+}
+
+func (c *streamConn) sendError(id string, errMsg ErrorMessage) error {
+	errMsgJSON, err := json.Marshal(errMsg)
+	if err != nil {
+		return err
+	}
+	return c.send(StreamMessage{ID: id, Data: errMsgJSON})
+}
+
+// Stream serves any number of resource watch and pod log subscriptions on a single WebSocket.
+func Stream(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		http.Error(w, "sessionID not provided", http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve user data using session ID
+	userData, err := k8sclient.GetSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := config.WebSocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		http.Error(w, "Could not upgrade connection to WebSocket", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	// Every subscription shares the connection's send queue, which also keeps it alive with pings
+	stream := &streamConn{queue: newSendQueue(conn)}
+	defer stream.queue.Close()
+
+	// Active subscriptions keyed by subscription ID, an ID is reserved before its subscription starts
+	subscriptions := make(map[string]*streamSubscription)
+	var subscriptionsMutex sync.Mutex
+
+	// removeSubscription forgets a subscription that ended on the server side, unless its ID was reused since
+	removeSubscription := func(id string, subscription *streamSubscription) {
+		subscriptionsMutex.Lock()
+		defer subscriptionsMutex.Unlock()
+		if subscriptions[id] == subscription {
+			delete(subscriptions, id)
+		}
+	}
+
+	defer func() {
+		subscriptionsMutex.Lock()
+		defer subscriptionsMutex.Unlock()
+		for id, subscription := range subscriptions {
+			subscription.stop()
+			delete(subscriptions, id)
+		}
+	}()
+
+	// Read subscribe/unsubscribe frames until the client disconnects
+	for {
+		_, requestJSON, err := conn.ReadMessage()
+		if err != nil {
+			// WebSocket disconnected, the deferred cleanup stops every subscription
+			stream.queue.Abort(err)
+			return
+		}
+
+		var request StreamRequest
+		if err := json.Unmarshal(requestJSON, &request); err != nil {
+			stream.sendError("", ErrorMessage{Error: fmt.Sprintf("invalid stream request: %s", err.Error())})
+			continue
+		}
+
+		if request.ID == "" {
+			stream.sendError("", ErrorMessage{Error: "stream request id must be provided"})
+			continue
+		}
+
+		switch request.Type {
+		case "subscribe":
+			subscription := &streamSubscription{}
+			subscriptionsMutex.Lock()
+			_, exists := subscriptions[request.ID]
+			if !exists {
+				subscriptions[request.ID] = subscription
+			}
+			subscriptionsMutex.Unlock()
+			if exists {
+				stream.sendError(request.ID, ErrorMessage{Error: fmt.Sprintf("subscription %s already exists", request.ID)})
+				continue
+			}
+
+			// The subscription may end, and forget itself, before it is even returned here
+			id := request.ID
+			done := func() { removeSubscription(id, subscription) }
+			var cancel func()
+			if request.Log != nil {
+				cancel, err = subscribePodLogs(stream, userData, request, done)
+			} else {
+				cancel, err = subscribeResources(stream, sessionID, request, done)
+			}
+			if err != nil {
+				removeSubscription(request.ID, subscription)
+				stream.sendError(request.ID, ErrorMessage{Error: err.Error()})
+				continue
+			}
+
+			subscriptionsMutex.Lock()
+			subscription.cancel = cancel
+			subscriptionsMutex.Unlock()
+		case "unsubscribe":
+			subscriptionsMutex.Lock()
+			if subscription, ok := subscriptions[request.ID]; ok {
+				subscription.stop()
+				delete(subscriptions, request.ID)
+			}
+			subscriptionsMutex.Unlock()
+		default:
+			stream.sendError(request.ID, ErrorMessage{Error: fmt.Sprintf("unsupported stream request type: %s", request.Type)})
+		}
+	}
+}
+
+// streamSubscription is an entry of the subscriptions of a stream, cancel is nil until the subscription has started
+type streamSubscription struct {
+	cancel func()
+}
+
+// stop cancels the subscription, it must be called with the subscriptions mutex held
+func (s *streamSubscription) stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// subscribeResources starts a resource watch subscription, its events are sent as the resource watcher list payloads.
+func subscribeResources(stream *streamConn, sessionID string, request StreamRequest, done func()) (func(), error) {
+	if request.ResourceType == "" || request.Namespace == "" {
+		return nil, fmt.Errorf("namespace and resourceType must be provided")
+	}
+
+	selector, err := k8sclient.NewResourceSelector(request.LabelSelector, request.FieldSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := NewBatchOptions(request.BatchInterval, request.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	delta, err := NewDeltaMode(request.Delta)
+	if err != nil {
+		return nil, err
+	}
+
+	stopCh := make(chan struct{})
+	forwarder := &watchForwarder{
+		queue:        stream.queue,
+		id:           request.ID,
+		sessionID:    sessionID,
+		namespace:    request.Namespace,
+		resourceType: request.ResourceType,
+		selector:     selector,
+		batch:        batch,
+		delta:        delta,
+		frame: func(data []byte) []byte {
+			return stream.frame(request.ID, data)
+		},
+	}
+	doneCh, err := forwarder.Start(stopCh)
+	if err != nil {
+		return nil, fmt.Errorf("Resource: %s for Namspace: %s - %s", request.ResourceType, request.Namespace, err)
+	}
+
+	go func() {
+		<-doneCh
+
+		// Tell the client the watch ended unless it unsubscribed itself
+		select {
+		case <-stopCh:
+		default:
+			done()
+			stream.send(StreamMessage{ID: request.ID, Done: true})
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stopCh) })
+	}, nil
+}
+
+// subscribePodLogs starts a pod log subscription, every line is sent as the pod logs LogMessage payload.
+func subscribePodLogs(stream *streamConn, userData *k8sclient.UserData, request StreamRequest, done func()) (func(), error) {
+	target := request.Log
+	if target.Namespace == "" || target.Pod == "" || target.Container == "" {
+		return nil, fmt.Errorf("log namespace, pod and container must be provided")
+	}
+	logOptions, err := target.PodLogOptions(target.Container, true)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := target.LogFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		err := K8sStreamPodLogs(ctx, userData, target.Namespace, target.Pod, logOptions, filter, func(jsonData []byte) error {
+			return stream.queue.Send(stream.frame(request.ID, jsonData))
+		})
+
+		// Tell the client the stream ended unless it unsubscribed itself
+		if ctx.Err() == nil {
+			done()
+			if err != nil {
+				stream.sendError(request.ID, ErrorMessage{Error: fmt.Sprintf("Pod: %s logs", target.Pod), K8sError: err.Error()})
+			}
+			stream.send(StreamMessage{ID: request.ID, Done: true})
+		}
+		cancel()
+	}()
+
+	return cancel, nil
+}
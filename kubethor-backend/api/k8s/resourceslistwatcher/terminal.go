@@ -0,0 +1,227 @@
+package resourceslistwatcher
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// TerminalMessage is every frame of a terminal WebSocket. The client sends stdin and resize frames,
+// the server sends stdout, stderr, a final exit frame, and error frames. A debug session starts with a container frame.
+type TerminalMessage struct {
+	Type     string `json:"type"` // stdin | resize | stdout | stderr | exit | error | container
+	Data     string `json:"data,omitempty"`
+	Rows     uint16 `json:"rows,omitempty"`
+	Cols     uint16 `json:"cols,omitempty"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+}
+
+// errStdinNotAttached ends the stdin pipe of a session whose container doesn't keep stdin open
+var errStdinNotAttached = errors.New("stdin is not attached, the container doesn't have stdin: true")
+
+// terminalSession bridges a browser WebSocket to the streams of a remotecommand executor:
+// it is the stdin reader, the TTY size queue, and hands out the stdout and stderr writers.
+type terminalSession struct {
+	conn        *websocket.Conn
+	queue       *sendQueue
+	stdinReader *io.PipeReader
+	stdinWriter *io.PipeWriter
+	sizeCh      chan remotecommand.TerminalSize
+	doneCh      chan struct{}
+	once        sync.Once
+	// stdinDropped is set once the client was told its stdin frames are dropped, only readMessages uses it
+	stdinDropped bool
+}
+
+func newTerminalSession(conn *websocket.Conn) *terminalSession {
+	stdinReader, stdinWriter := io.Pipe()
+	session := &terminalSession{
+		conn:        conn,
+		queue:       newSendQueue(conn),
+		stdinReader: stdinReader,
+		stdinWriter: stdinWriter,
+		sizeCh:      make(chan remotecommand.TerminalSize, 1),
+		doneCh:      make(chan struct{}),
+	}
+
+	go session.readMessages()
+
+	return session
+}
+
+// readMessages forwards the stdin and resize frames until the client disconnects
+func (t *terminalSession) readMessages() {
+	defer t.stop()
+
+	for {
+		_, messageJSON, err := t.conn.ReadMessage()
+		if err != nil {
+			// WebSocket disconnected, nothing left to flush
+			t.queue.Abort(err)
+			return
+		}
+
+		var message TerminalMessage
+		if err := json.Unmarshal(messageJSON, &message); err != nil {
+			t.sendMessage(TerminalMessage{Type: "error", Data: "invalid terminal message: " + err.Error()})
+			continue
+		}
+
+		switch message.Type {
+		case "stdin":
+			if _, err := t.stdinWriter.Write([]byte(message.Data)); err != nil {
+				// Nothing reads stdin, drop the frame but keep reading to notice the client disconnecting
+				if errors.Is(err, errStdinNotAttached) {
+					if !t.stdinDropped {
+						t.stdinDropped = true
+						t.sendMessage(TerminalMessage{Type: "error", Data: err.Error()})
+					}
+					continue
+				}
+				return
+			}
+		case "resize":
+			if message.Rows == 0 || message.Cols == 0 {
+				continue
+			}
+			// Only the latest size matters, replace one the executor hasn't picked up yet
+			select {
+			case <-t.sizeCh:
+			default:
+			}
+			t.sizeCh <- remotecommand.TerminalSize{Width: message.Cols, Height: message.Rows}
+		default:
+			t.sendMessage(TerminalMessage{Type: "error", Data: "unsupported terminal message type: " + message.Type})
+		}
+	}
+}
+
+// Done is closed once the client disconnected
+func (t *terminalSession) Done() <-chan struct{} {
+	return t.doneCh
+}
+
+// stop ends stdin and the size queue
+func (t *terminalSession) stop() {
+	t.once.Do(func() {
+		t.stdinWriter.Close()
+		close(t.doneCh)
+	})
+}
+
+// Close ends the session and flushes the frames still queued
+func (t *terminalSession) Close() {
+	t.stop()
+	t.queue.Close()
+}
+
+// Read implements the stdin stream
+func (t *terminalSession) Read(p []byte) (int, error) {
+	return t.stdinReader.Read(p)
+}
+
+// Next implements remotecommand.TerminalSizeQueue, nil ends the resizing
+func (t *terminalSession) Next() *remotecommand.TerminalSize {
+	select {
+	case size := <-t.sizeCh:
+		return &size
+	case <-t.doneCh:
+		return nil
+	}
+}
+
+func (t *terminalSession) sendMessage(message TerminalMessage) error {
+	messageJSON, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return t.queue.Send(messageJSON)
+}
+
+// SendExit sends the exit frame, with the exit code of the command when the executor returned one
+func (t *terminalSession) SendExit(err error) {
+	exitCode := 0
+	var exitErr utilexec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		exitCode = exitErr.ExitStatus()
+	default:
+		t.sendMessage(TerminalMessage{Type: "error", Data: err.Error()})
+		return
+	}
+	t.sendMessage(TerminalMessage{Type: "exit", ExitCode: &exitCode})
+}
+
+// StreamOptions bridges stdin and stdout to the session, with resizing when a TTY is allocated
+// and a separate stderr stream otherwise.
+func (t *terminalSession) StreamOptions(tty bool) remotecommand.StreamOptions {
+	streamOptions := remotecommand.StreamOptions{
+		Stdin:  t,
+		Stdout: t.Writer("stdout"),
+		Tty:    tty,
+	}
+	if tty {
+		streamOptions.TerminalSizeQueue = t
+	} else {
+		streamOptions.Stderr = t.Writer("stderr")
+	}
+	return streamOptions
+}
+
+// AttachStreamOptions is StreamOptions for attaching to a container, without stdin when the container doesn't
+// keep it open. The stdin frames of the client are dropped then, a write already waiting for a reader included.
+func (t *terminalSession) AttachStreamOptions(stdin, tty bool) remotecommand.StreamOptions {
+	streamOptions := t.StreamOptions(tty)
+	if !stdin {
+		t.stdinReader.CloseWithError(errStdinNotAttached)
+		streamOptions.Stdin = nil
+	}
+	return streamOptions
+}
+
+// Writer returns the writer for the stdout or stderr stream
+func (t *terminalSession) Writer(streamType string) io.Writer {
+	return &terminalWriter{session: t, streamType: streamType}
+}
+
+// terminalWriter sends the output of a stream as frames. Frames carry text, so a UTF-8 sequence
+// split across writes is held back until it is complete.
+type terminalWriter struct {
+	session    *terminalSession
+	streamType string
+	pending    []byte
+}
+
+func (w *terminalWriter) Write(p []byte) (int, error) {
+	data := append(w.pending, p...)
+	complete := len(data) - incompleteRuneSuffix(data)
+	w.pending = append([]byte(nil), data[complete:]...)
+	if complete == 0 {
+		return len(p), nil
+	}
+
+	if err := w.session.sendMessage(TerminalMessage{Type: w.streamType, Data: string(data[:complete])}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// incompleteRuneSuffix returns the length of a truncated UTF-8 sequence at the end of data
+func incompleteRuneSuffix(data []byte) int {
+	for i := 1; i <= utf8.UTFMax-1 && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if utf8.FullRune(data[len(data)-i:]) {
+				return 0
+			}
+			return i
+		}
+	}
+	return 0
+}
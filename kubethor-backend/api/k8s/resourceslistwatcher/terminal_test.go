@@ -0,0 +1,65 @@
+package resourceslistwatcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// An attach without stdin must drop the stdin frames and still end the session once the client disconnects
+func TestTerminalSessionWithoutStdinEndsOnDisconnect(t *testing.T) {
+	sessionCh := make(chan *terminalSession, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		sessionCh <- newTerminalSession(conn)
+	}))
+	defer server.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+	session := <-sessionCh
+	defer session.Close()
+
+	// The first frame arrives before the streams are known, its write waits for a reader
+	if err := client.WriteJSON(TerminalMessage{Type: "stdin", Data: "a"}); err != nil {
+		t.Fatalf("write stdin: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	streamOptions := session.AttachStreamOptions(false, false)
+	if streamOptions.Stdin != nil {
+		t.Fatal("stdin stream set for a container without stdin")
+	}
+
+	if err := client.WriteJSON(TerminalMessage{Type: "stdin", Data: "b"}); err != nil {
+		t.Fatalf("write stdin: %v", err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message TerminalMessage
+	if err := client.ReadJSON(&message); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if message.Type != "error" || message.Data != errStdinNotAttached.Error() {
+		t.Fatalf("got %+v, want the stdin not attached error", message)
+	}
+
+	client.Close()
+	select {
+	case <-session.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session not done after the client disconnected")
+	}
+}
@@ -17,8 +17,37 @@ func RegisterK8sRouters(r *mux.Router) {
 	r.HandleFunc("/resource-update/{resource_type}/{namespace_name}", resources.UpdateResource).Methods("POST")
 	r.HandleFunc("/resource-update-configmap-datakey/{namespace_name}/{config_map_name}/{config_map_data_key}", resources.UpdateConfigMapDataKey).Methods("POST")
 	r.HandleFunc("/resource-update-deployment-container-image/{namespace_name}/{deployment_name}/{container_name}", resources.UpdateDeploymentContainerImage).Methods("POST")
+	r.HandleFunc("/resource-set-image/{resource_type}/{namespace_name}/{resource_name}", resources.SetImage).Methods("POST")
+	r.HandleFunc("/resource-set-env/{resource_type}/{namespace_name}/{resource_name}/{container_name}", resources.SetContainerEnv).Methods("POST")
+	r.HandleFunc("/resource-set-resources/{resource_type}/{namespace_name}/{resource_name}/{container_name}", resources.SetContainerResources).Methods("POST")
+	r.HandleFunc("/resource-scale/{resource_type}/{namespace_name}/{resource_name}", resources.ScaleResource).Methods("POST")
+	r.HandleFunc("/rollout-restart/{resource_type}/{namespace_name}/{resource_name}", resources.RolloutRestart).Methods("POST")
+	r.HandleFunc("/rollout-pause/{resource_type}/{namespace_name}/{resource_name}", resources.RolloutPause).Methods("POST")
+	r.HandleFunc("/rollout-resume/{resource_type}/{namespace_name}/{resource_name}", resources.RolloutResume).Methods("POST")
+	r.HandleFunc("/rollout-history/{resource_type}/{namespace_name}/{resource_name}", resources.RolloutHistory).Methods("GET")
+	r.HandleFunc("/rollout-undo/{resource_type}/{namespace_name}/{resource_name}", resources.RolloutUndo).Methods("POST")
+	r.HandleFunc("/pod-file/{namespace_name}/{pod_name}/{container_name}", resources.DownloadPodFile).Methods("GET")
+	r.HandleFunc("/pod-file/{namespace_name}/{pod_name}/{container_name}", resources.UploadPodFiles).Methods("POST")
+	r.HandleFunc("/pod-logs/{namespace_name}/{pod_name}/{container_name}", resources.GetPodLogs).Methods("GET")
+	r.HandleFunc("/pod-logs-archive/{namespace_name}", resources.DownloadPodLogsArchive).Methods("GET")
+	r.HandleFunc("/pod-debug/{namespace_name}/{pod_name}", resources.CreateDebugContainer).Methods("POST")
+
+	// ******Port Forward ******
+	r.HandleFunc("/port-forward", resources.ListPortForwards).Methods("GET")
+	r.HandleFunc("/port-forward/{namespace_name}/{pod_name}/{port:[0-9]+}", resources.StopPortForward).Methods("DELETE")
+	r.HandleFunc("/port-forward/{namespace_name}/{pod_name}/{port:[0-9]+}", resources.PortForwardRedirect)
+	r.HandleFunc("/port-forward/{namespace_name}/{pod_name}/{port:[0-9]+}/{path:.*}", resources.PortForwardProxy)
+	r.HandleFunc("/port-forward-service/{namespace_name}/{service_name}/{port:[0-9]+}", resources.PortForwardRedirect)
+	r.HandleFunc("/port-forward-service/{namespace_name}/{service_name}/{port:[0-9]+}/{path:.*}", resources.ServicePortForwardProxy)
 
 	// ******Resources List Watcher (Websockets) ******
 	r.HandleFunc("/ws/resource-watcher/list/{resource_type}/{namespace_name}", resourceslistwatcher.ListResources)
 	r.HandleFunc("/ws/resource-watcher/pod-logs/{namespace_name}/{pod_name}/{container_name}", resourceslistwatcher.WatchPodLogs)
+	r.HandleFunc("/ws/resource-watcher/aggregated-pod-logs/{namespace_name}", resourceslistwatcher.WatchAggregatedPodLogs)
+	r.HandleFunc("/ws/stream", resourceslistwatcher.Stream)
+	r.HandleFunc("/ws/resource-watcher/rollout-status/{resource_type}/{namespace_name}/{resource_name}", resourceslistwatcher.WatchRolloutStatus)
+	r.HandleFunc("/ws/pod-exec/{namespace_name}/{pod_name}/{container_name}", resourceslistwatcher.PodExec)
+	r.HandleFunc("/ws/pod-attach/{namespace_name}/{pod_name}/{container_name}", resourceslistwatcher.PodAttach)
+	r.HandleFunc("/ws/pod-debug/{namespace_name}/{pod_name}", resourceslistwatcher.PodDebug)
+	r.HandleFunc("/ws/port-forward/{namespace_name}/{pod_name}/{port:[0-9]+}", resourceslistwatcher.PortForwardTunnel)
 }
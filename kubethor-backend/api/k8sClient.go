@@ -14,34 +14,60 @@ import (
 	"io/ioutil"
 	"runtime"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 )
 
 type UserData struct {
-	Clientset        *kubernetes.Clientset
-	Namespace        string
-	NamespaceList    []string
-	ExpirationTime   time.Time
+	Clientset      *kubernetes.Clientset
+	RestConfig     *rest.Config
+	DynamicClient  dynamic.Interface
+	RESTMapper     meta.RESTMapper
+	Informers      *InformerCache
+	PortForwards   *PortForwardCache
+	Namespace      string
+	NamespaceList  []string
+	ExpirationTime time.Time
 }
 
+// AllNamespaces is the reserved {namespace_name} value to list and watch resources across all namespaces
+const AllNamespaces = "_all"
+
 var (
 	SessionMap = make(map[string]*UserData) // Map to store user data, keyed by session ID
 	mapMutex   sync.Mutex                   // Mutex to ensure thread-safe access to SessionMap
 )
 
-func InitializeSession(sessionID string, clientset *kubernetes.Clientset, namespace string, namespaceList []string) {
+func InitializeSession(sessionID string, config *rest.Config, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, namespace string, namespaceList []string) {
+	// The discovery cache is refreshed by the deferred mapper whenever a lookup misses,
+	// so CRDs installed after the session was created are still resolved.
+	discoveryClient := memory.NewMemCacheClient(clientset.Discovery())
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient)
+
 	// Initialize user data and store it in the map
 	user := &UserData{
-		Clientset:        clientset,
-		Namespace:        namespace,
-		NamespaceList:    namespaceList,
-		ExpirationTime:   time.Now().Add(1 * time.Hour),
+		Clientset:      clientset,
+		RestConfig:     config,
+		DynamicClient:  dynamicClient,
+		RESTMapper:     restmapper.NewShortcutExpander(mapper, discoveryClient, nil),
+		Informers:      NewInformerCache(clientset, dynamicClient),
+		PortForwards:   NewPortForwardCache(clientset, config),
+		Namespace:      namespace,
+		NamespaceList:  namespaceList,
+		ExpirationTime: time.Now().Add(1 * time.Hour),
 	}
 	mapMutex.Lock()
+	// Stop the informers and port-forwards of a previous connection reusing this session ID
+	if previous, ok := SessionMap[sessionID]; ok {
+		previous.stop()
+	}
 	SessionMap[sessionID] = user
 	mapMutex.Unlock()
 }
@@ -49,13 +75,25 @@ func InitializeSession(sessionID string, clientset *kubernetes.Clientset, namesp
 func DeleteSession(sessionID string) error {
 	mapMutex.Lock()
 	defer mapMutex.Unlock()
-	if _, ok := SessionMap[sessionID]; !ok {
+	user, ok := SessionMap[sessionID]
+	if !ok {
 		return fmt.Errorf("session not found")
 	}
+	user.stop()
 	delete(SessionMap, sessionID)
 	return nil
 }
 
+// stop stops the informers and port-forwards of the session
+func (u *UserData) stop() {
+	if u.Informers != nil {
+		u.Informers.Stop()
+	}
+	if u.PortForwards != nil {
+		u.PortForwards.Stop()
+	}
+}
+
 func RefreshSession(w http.ResponseWriter, r *http.Request) {
 	sessionID := r.Header.Get("X-Session-Id")
 	if sessionID == "" {
@@ -94,6 +132,7 @@ func CleanupSessions() {
 			mapMutex.Lock()
 			for sessionID, user := range SessionMap {
 				if user.ExpirationTime.Before(now) {
+					user.stop()
 					delete(SessionMap, sessionID)
 				}
 			}
@@ -201,6 +240,14 @@ func GetNamespaceList(clientset *kubernetes.Clientset) ([]string, error) {
 	return namespaceList, nil
 }
 
+// GetSessionNamespaces returns the namespaces of the session, refreshed from the cluster when the user may list them.
+func GetSessionNamespaces(userData *UserData) []string {
+	if namespaceList, err := GetNamespaceList(userData.Clientset); err == nil {
+		return namespaceList
+	}
+	return userData.NamespaceList
+}
+
 func GetNamespaceFromKubeConfig(kubeconfigPath string) (string, error) {
 	if kubeconfigPath == "" {
 		kubeconfigPath = filepath.Join(homedir.HomeDir(), ".kube", "config")
@@ -300,6 +347,12 @@ func Setk8sClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		JSONResponse(w, fmt.Sprintf("Error creating dynamic client: %v", err), false, http.StatusInternalServerError, nil, "")
+		return
+	}
+
 	// Retrieve the list of namespaces from the Kubernetes cluster
 	namespaceList, err := GetNamespaceList(clientset)
 	if err != nil {
@@ -318,7 +371,7 @@ func Setk8sClient(w http.ResponseWriter, r *http.Request) {
 		currentContextNamespace = namespaceList[0]
 	}
 
-	InitializeSession(sessionID, clientset, currentContextNamespace, namespaceList)
+	InitializeSession(sessionID, config, clientset, dynamicClient, currentContextNamespace, namespaceList)
 
 	// Print all sessions and their count
 	// _PrintSessions()
@@ -378,8 +431,8 @@ func SetClientSetToNil(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set session's clientset to nil
-	delete(SessionMap, sessionID)
+	// Set session's clientset to nil, this also stops the session's informers
+	DeleteSession(sessionID)
 
 	// Respond with success message
 	w.WriteHeader(http.StatusOK)
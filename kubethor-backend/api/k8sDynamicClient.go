@@ -0,0 +1,70 @@
+package api
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// GetResourceMapping resolves a {resource_type} route value into a REST mapping using the discovery API.
+// It accepts kinds ("StatefulSet"), plural or short resource names ("statefulsets", "sts")
+// and group qualified names ("cronjobs.batch", "certificates.v1.cert-manager.io").
+func GetResourceMapping(userData *UserData, resourceType string) (*meta.RESTMapping, error) {
+	// Check if the rest mapper is properly initialized
+	if userData.RESTMapper == nil {
+		return nil, fmt.Errorf("rest mapper is nil, clientset not properly initialized")
+	}
+	mapper := userData.RESTMapper
+
+	// Try to treat the value as a resource first (pods, deploy, cronjobs.batch, ...)
+	fullySpecifiedGVR, groupResource := schema.ParseResourceArg(resourceType)
+	gvk := schema.GroupVersionKind{}
+	if fullySpecifiedGVR != nil {
+		gvk, _ = mapper.KindFor(*fullySpecifiedGVR)
+	}
+	if gvk.Empty() {
+		gvk, _ = mapper.KindFor(groupResource.WithVersion(""))
+	}
+	if !gvk.Empty() {
+		return mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+
+	// Otherwise treat it as a kind (Deployment, Deployment.apps, Deployment.v1.apps)
+	fullySpecifiedGVK, groupKind := schema.ParseKindArg(resourceType)
+	if fullySpecifiedGVK != nil {
+		if mapping, err := mapper.RESTMapping(fullySpecifiedGVK.GroupKind(), fullySpecifiedGVK.Version); err == nil {
+			return mapping, nil
+		}
+	}
+
+	mapping, err := mapper.RESTMapping(groupKind)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
+		}
+		return nil, err
+	}
+
+	return mapping, nil
+}
+
+// GetDynamicResource returns a dynamic client for the resolved resource type, scoped to the
+// namespace only when the resource is namespaced. Cluster-scoped resources ignore the namespace.
+func GetDynamicResource(userData *UserData, resourceType, namespace string) (dynamic.ResourceInterface, *meta.RESTMapping, error) {
+	// Check if dynamic client is properly initialized
+	if userData.DynamicClient == nil {
+		return nil, nil, fmt.Errorf("dynamic client is nil, clientset not properly initialized")
+	}
+
+	mapping, err := GetResourceMapping(userData, resourceType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return userData.DynamicClient.Resource(mapping.Resource).Namespace(namespace), mapping, nil
+	}
+	return userData.DynamicClient.Resource(mapping.Resource), mapping, nil
+}
@@ -0,0 +1,336 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// TypedResource describes a resource type with a typed fast path, its informer delivers typed objects.
+type TypedResource struct {
+	GroupVersionResource schema.GroupVersionResource
+	Namespaced           bool
+	Object               runtime.Object
+}
+
+// TypedResources maps the {resource_type} values with a typed fast path to their pinned API version and object type.
+var TypedResources = map[string]TypedResource{
+	"Pod":                     {corev1.SchemeGroupVersion.WithResource("pods"), true, &corev1.Pod{}},
+	"Deployment":              {appsv1.SchemeGroupVersion.WithResource("deployments"), true, &appsv1.Deployment{}},
+	"ConfigMap":               {corev1.SchemeGroupVersion.WithResource("configmaps"), true, &corev1.ConfigMap{}},
+	"Job":                     {batchv1.SchemeGroupVersion.WithResource("jobs"), true, &batchv1.Job{}},
+	"Service":                 {corev1.SchemeGroupVersion.WithResource("services"), true, &corev1.Service{}},
+	"Secret":                  {corev1.SchemeGroupVersion.WithResource("secrets"), true, &corev1.Secret{}},
+	"HorizontalPodAutoscaler": {autoscalingv1.SchemeGroupVersion.WithResource("horizontalpodautoscalers"), true, &autoscalingv1.HorizontalPodAutoscaler{}},
+	"Ingress":                 {networkingv1.SchemeGroupVersion.WithResource("ingresses"), true, &networkingv1.Ingress{}},
+	"Endpoints":               {corev1.SchemeGroupVersion.WithResource("endpoints"), true, &corev1.Endpoints{}},
+	"ServiceAccount":          {corev1.SchemeGroupVersion.WithResource("serviceaccounts"), true, &corev1.ServiceAccount{}},
+	"PersistentVolumeClaim":   {corev1.SchemeGroupVersion.WithResource("persistentvolumeclaims"), true, &corev1.PersistentVolumeClaim{}},
+	"Namespace":               {corev1.SchemeGroupVersion.WithResource("namespaces"), false, &corev1.Namespace{}},
+	"Node":                    {corev1.SchemeGroupVersion.WithResource("nodes"), false, &corev1.Node{}},
+	"Event":                   {corev1.SchemeGroupVersion.WithResource("events"), true, &corev1.Event{}},
+}
+
+// InformerCache keeps one shared informer per resource and namespace for a session, so any number of
+// WebSocket subscribers and REST reads for the same kind/namespace are served from a single watch.
+// Informers are reference counted by their subscribers and stopped once the last one leaves.
+type InformerCache struct {
+	clientset     kubernetes.Interface
+	dynamicClient dynamic.Interface
+	informers     map[string]*informerEntry
+	stopped       bool
+	mutex         sync.Mutex
+}
+
+// informerEntry is a running informer, stopped by closing stopCh once refs drops to zero
+type informerEntry struct {
+	informer *ResourceInformer
+	stopCh   chan struct{}
+	refs     int
+}
+
+func NewInformerCache(clientset kubernetes.Interface, dynamicClient dynamic.Interface) *InformerCache {
+	return &InformerCache{
+		clientset:     clientset,
+		dynamicClient: dynamicClient,
+		informers:     make(map[string]*informerEntry),
+	}
+}
+
+// Stop stops every informer of the session, it is called when the session is deleted or expires.
+func (c *InformerCache) Stop() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stopped {
+		return
+	}
+	c.stopped = true
+	for key, entry := range c.informers {
+		close(entry.stopCh)
+		delete(c.informers, key)
+	}
+}
+
+// Informer returns the shared informer for the resource in the namespace, creating and starting it on first use.
+// Informers are keyed by their selectors too, as the filtering happens on the API server. typedObject is the object
+// type of typed fast paths, nil lists and watches through the dynamic client. The caller must call the returned
+// release function once it no longer uses the informer.
+func (c *InformerCache) Informer(gvr schema.GroupVersionResource, namespace string, selector ResourceSelector, typedObject runtime.Object) (*ResourceInformer, func(), error) {
+	key := informerKey(gvr, namespace, selector)
+	if informer, release, ok, err := c.acquire(key); ok || err != nil {
+		return informer, release, err
+	}
+
+	// Probe access before starting the informer, otherwise a forbidden or unknown resource
+	// would retry in the background forever without the subscriber ever seeing the error.
+	// The probe goes over the network, so it runs without holding the lock.
+	probeOptions := selector.ListOptions()
+	probeOptions.Limit = 1
+	if _, err := c.dynamicClient.Resource(gvr).Namespace(namespace).List(context.TODO(), probeOptions); err != nil {
+		return nil, nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stopped {
+		return nil, nil, fmt.Errorf("informer cache is stopped, session expired")
+	}
+	// Another subscriber may have started it while probing
+	if entry, ok := c.informers[key]; ok {
+		entry.refs++
+		return entry.informer, c.releaseFunc(key, entry), nil
+	}
+
+	var listWatch cache.ListerWatcher
+	exampleObject := typedObject
+	if typedObject != nil {
+		restClient, err := c.typedRESTClient(gvr.GroupVersion())
+		if err != nil {
+			return nil, nil, err
+		}
+		listWatch = cache.NewFilteredListWatchFromClient(restClient, gvr.Resource, namespace, selector.ApplyToListOptions)
+	} else {
+		resource := c.dynamicClient.Resource(gvr).Namespace(namespace)
+		listWatch = &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				selector.ApplyToListOptions(&options)
+				return resource.List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				selector.ApplyToListOptions(&options)
+				return resource.Watch(context.TODO(), options)
+			},
+		}
+		exampleObject = &unstructured.Unstructured{}
+	}
+
+	entry := &informerEntry{
+		informer: newResourceInformer(listWatch, exampleObject),
+		stopCh:   make(chan struct{}),
+		refs:     1,
+	}
+	go entry.informer.Run(entry.stopCh)
+
+	c.informers[key] = entry
+	return entry.informer, c.releaseFunc(key, entry), nil
+}
+
+// typedRESTClient returns the clientset's REST client of the API group version of a typed fast path
+func (c *InformerCache) typedRESTClient(groupVersion schema.GroupVersion) (rest.Interface, error) {
+	switch groupVersion {
+	case corev1.SchemeGroupVersion:
+		return c.clientset.CoreV1().RESTClient(), nil
+	case appsv1.SchemeGroupVersion:
+		return c.clientset.AppsV1().RESTClient(), nil
+	case batchv1.SchemeGroupVersion:
+		return c.clientset.BatchV1().RESTClient(), nil
+	case autoscalingv1.SchemeGroupVersion:
+		return c.clientset.AutoscalingV1().RESTClient(), nil
+	case networkingv1.SchemeGroupVersion:
+		return c.clientset.NetworkingV1().RESTClient(), nil
+	}
+	return nil, fmt.Errorf("no typed client for %s", groupVersion)
+}
+
+// acquire takes a reference on a running informer, ok is false when there is none yet
+func (c *InformerCache) acquire(key string) (*ResourceInformer, func(), bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stopped {
+		return nil, nil, false, fmt.Errorf("informer cache is stopped, session expired")
+	}
+	entry, ok := c.informers[key]
+	if !ok {
+		return nil, nil, false, nil
+	}
+	entry.refs++
+	return entry.informer, c.releaseFunc(key, entry), true, nil
+}
+
+// releaseFunc drops the reference once, the informer is stopped when it was the last one
+func (c *InformerCache) releaseFunc(key string, entry *informerEntry) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+
+			entry.refs--
+			if entry.refs > 0 || c.informers[key] != entry {
+				return
+			}
+			close(entry.stopCh)
+			delete(c.informers, key)
+		})
+	}
+}
+
+// SyncedInformer returns the informer for the resource in the namespace only if one is already running and synced.
+func (c *InformerCache) SyncedInformer(gvr schema.GroupVersionResource, namespace string, selector ResourceSelector) (*ResourceInformer, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stopped {
+		return nil, false
+	}
+	entry, ok := c.informers[informerKey(gvr, namespace, selector)]
+	if !ok || !entry.informer.HasSynced() {
+		return nil, false
+	}
+	return entry.informer, true
+}
+
+func informerKey(gvr schema.GroupVersionResource, namespace string, selector ResourceSelector) string {
+	return fmt.Sprintf("%s/%s?%s", namespace, gvr.String(), selector)
+}
+
+// resolveInformerResource resolves the resource type into the GVR the informer is keyed by, typed fast paths first.
+func resolveInformerResource(userData *UserData, resourceType, namespace string) (schema.GroupVersionResource, string, runtime.Object, error) {
+	if namespace == AllNamespaces {
+		namespace = metav1.NamespaceAll
+	}
+
+	if typedResource, ok := TypedResources[resourceType]; ok {
+		if !typedResource.Namespaced {
+			namespace = metav1.NamespaceAll
+		}
+		return typedResource.GroupVersionResource, namespace, typedResource.Object, nil
+	}
+
+	mapping, err := GetResourceMapping(userData, resourceType)
+	if err != nil {
+		return schema.GroupVersionResource{}, "", nil, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		namespace = metav1.NamespaceAll
+	}
+	return mapping.Resource, namespace, nil, nil
+}
+
+// GetResourceInformer returns the session's shared informer for the resource type and namespace,
+// and the function releasing it once the caller stops using it.
+func GetResourceInformer(userData *UserData, resourceType, namespace string, selector ResourceSelector) (*ResourceInformer, func(), error) {
+	// Check if informer cache is properly initialized
+	if userData.Informers == nil {
+		return nil, nil, fmt.Errorf("informer cache is nil, clientset not properly initialized")
+	}
+
+	gvr, namespace, typedObject, err := resolveInformerResource(userData, resourceType, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	return userData.Informers.Informer(gvr, namespace, selector, typedObject)
+}
+
+// syncedResourceInformer returns the session's informer for the resource type and namespace
+// when it is already running and synced, along with the namespace the informer is keyed by.
+func syncedResourceInformer(userData *UserData, resourceType, namespace string, selector ResourceSelector) (*ResourceInformer, string, bool) {
+	if userData.Informers == nil {
+		return nil, "", false
+	}
+
+	gvr, namespace, _, err := resolveInformerResource(userData, resourceType, namespace)
+	if err != nil {
+		return nil, "", false
+	}
+	informer, ok := userData.Informers.SyncedInformer(gvr, namespace, selector)
+	return informer, namespace, ok
+}
+
+// GetCachedResource returns a copy of the resource from the session's informer cache, if a synced informer holds it.
+func GetCachedResource(userData *UserData, resourceType, namespace, name string) (runtime.Object, bool) {
+	informer, namespace, ok := syncedResourceInformer(userData, resourceType, namespace, ResourceSelector{})
+	if !ok {
+		return nil, false
+	}
+
+	item, exists, err := informer.GetIndexer().GetByKey(cache.ObjectName{Namespace: namespace, Name: name}.String())
+	if err != nil || !exists {
+		return nil, false
+	}
+	object, ok := item.(runtime.Object)
+	if !ok {
+		return nil, false
+	}
+
+	// Callers modify fetched objects before updating them, never hand out the cached pointer
+	return object.DeepCopyObject(), true
+}
+
+// CachedResourceList is the list response built from the session's informer cache.
+type CachedResourceList struct {
+	ApiVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Metadata   metav1.ListMeta  `json:"metadata"`
+	Items      []runtime.Object `json:"items"`
+}
+
+// GetCachedResourceList returns the resources from the session's informer cache sorted by key,
+// if a synced informer with the same selectors holds them.
+func GetCachedResourceList(userData *UserData, resourceType, namespace string, selector ResourceSelector) (*CachedResourceList, bool) {
+	informer, namespace, ok := syncedResourceInformer(userData, resourceType, namespace, selector)
+	if !ok {
+		return nil, false
+	}
+
+	indexer := informer.GetIndexer()
+	keys := indexer.ListKeys()
+	sort.Strings(keys)
+
+	list := &CachedResourceList{
+		ApiVersion: "v1",
+		Kind:       "List",
+		Metadata:   metav1.ListMeta{ResourceVersion: informer.LastSyncResourceVersion()},
+		Items:      []runtime.Object{},
+	}
+	for _, key := range keys {
+		item, exists, err := indexer.GetByKey(key)
+		if err != nil || !exists {
+			continue
+		}
+		if object, ok := item.(runtime.Object); ok {
+			list.Items = append(list.Items, object.DeepCopyObject())
+		}
+	}
+
+	return list, true
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// portForwardReadyTimeout bounds how long starting a port-forward waits for the tunnel to the pod
+const portForwardReadyTimeout = 30 * time.Second
+
+// PortForward is an active port-forward to a pod port, served on a loopback port of the backend.
+type PortForward struct {
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	Port      int       `json:"port"`
+	LocalPort int       `json:"localPort"`
+	StartedAt time.Time `json:"startedAt"`
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+	stopOnce  sync.Once
+	// startedCh is closed once starting finished, startErr is set if it failed
+	startedCh chan struct{}
+	startErr  error
+}
+
+// LocalAddress returns the loopback address the pod port is reachable on
+func (f *PortForward) LocalAddress() string {
+	return fmt.Sprintf("127.0.0.1:%d", f.LocalPort)
+}
+
+// Done is closed once the port-forward stopped, because it was stopped or the connection to the pod was lost
+func (f *PortForward) Done() <-chan struct{} {
+	return f.doneCh
+}
+
+func (f *PortForward) stop() {
+	f.stopOnce.Do(func() { close(f.stopCh) })
+}
+
+// wait blocks until the port-forward started, it returns the error starting it failed with
+func (f *PortForward) wait() error {
+	<-f.startedCh
+	return f.startErr
+}
+
+// started reports whether the port-forward is ready, a starting one is not listed yet
+func (f *PortForward) started() bool {
+	select {
+	case <-f.startedCh:
+		return f.startErr == nil
+	default:
+		return false
+	}
+}
+
+// PortForwardCache keeps the active port-forwards of a session, so every proxied request
+// and tunnel to the same pod port reuses one connection to the API server.
+type PortForwardCache struct {
+	clientset  kubernetes.Interface
+	restConfig *rest.Config
+	forwards   map[string]*PortForward
+	stopped    bool
+	mutex      sync.Mutex
+}
+
+func NewPortForwardCache(clientset kubernetes.Interface, restConfig *rest.Config) *PortForwardCache {
+	return &PortForwardCache{
+		clientset:  clientset,
+		restConfig: restConfig,
+		forwards:   make(map[string]*PortForward),
+	}
+}
+
+func portForwardKey(namespace, pod string, port int) string {
+	return fmt.Sprintf("%s/%s:%d", namespace, pod, port)
+}
+
+// PortForward returns the active port-forward to the pod port, starting it on first use.
+// Concurrent requests for a port-forward that is still starting wait for it instead of dialing again.
+func (c *PortForwardCache) PortForward(namespace, pod string, port int) (*PortForward, error) {
+	c.mutex.Lock()
+	if c.stopped {
+		c.mutex.Unlock()
+		return nil, fmt.Errorf("port-forward cache is stopped, session expired")
+	}
+
+	key := portForwardKey(namespace, pod, port)
+	if forward, ok := c.forwards[key]; ok {
+		c.mutex.Unlock()
+		if err := forward.wait(); err != nil {
+			return nil, err
+		}
+		return forward, nil
+	}
+
+	// Reserve the key while dialing, which happens without holding the mutex
+	forward := &PortForward{
+		Namespace: namespace,
+		Pod:       pod,
+		Port:      port,
+		StartedAt: time.Now(),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+		startedCh: make(chan struct{}),
+	}
+	c.forwards[key] = forward
+	c.mutex.Unlock()
+
+	err := c.start(forward)
+	if err != nil {
+		forward.stop()
+		c.mutex.Lock()
+		if c.forwards[key] == forward {
+			delete(c.forwards, key)
+		}
+		c.mutex.Unlock()
+	}
+	forward.startErr = err
+	close(forward.startedCh)
+	if err != nil {
+		return nil, err
+	}
+
+	// Forget the port-forward once it stops, the next request starts a new one
+	go func() {
+		<-forward.doneCh
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if c.forwards[key] == forward {
+			delete(c.forwards, key)
+		}
+	}()
+
+	return forward, nil
+}
+
+// start dials the pod and waits until the port-forward is ready, it must be called without the mutex held
+func (c *PortForwardCache) start(forward *PortForward) error {
+	key := portForwardKey(forward.Namespace, forward.Pod, forward.Port)
+	url := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(forward.Namespace).
+		Name(forward.Pod).
+		SubResource("portforward").
+		URL()
+
+	// Tunnel over WebSockets, falling back to SPDY when the API server can't upgrade to it
+	transport, upgrader, err := spdy.RoundTripperFor(c.restConfig)
+	if err != nil {
+		return err
+	}
+	spdyDialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", url)
+	websocketDialer, err := portforward.NewSPDYOverWebsocketDialer(url, c.restConfig)
+	if err != nil {
+		return err
+	}
+	dialer := portforward.NewFallbackDialer(websocketDialer, spdyDialer, httpstream.IsUpgradeFailure)
+
+	// Local port 0 picks a free loopback port, it is never exposed outside the backend
+	readyCh := make(chan struct{})
+	errOut := &portForwardLogWriter{prefix: fmt.Sprintf("Port-forward %s: ", key)}
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", forward.Port)}, forward.stopCh, readyCh, io.Discard, errOut)
+	if err != nil {
+		return err
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(forward.doneCh)
+		if err := forwarder.ForwardPorts(); err != nil {
+			errCh <- err
+		}
+	}()
+
+	// ForwardPorts also returns without an error when the port-forward is stopped before it got ready
+	timeout := time.NewTimer(portForwardReadyTimeout)
+	defer timeout.Stop()
+	select {
+	case <-readyCh:
+	case <-forward.doneCh:
+		select {
+		case err := <-errCh:
+			return err
+		default:
+			return fmt.Errorf("port-forward to %s stopped before it was ready", key)
+		}
+	case <-timeout.C:
+		return fmt.Errorf("port-forward to %s not ready after %s", key, portForwardReadyTimeout)
+	}
+
+	ports, err := forwarder.GetPorts()
+	if err != nil || len(ports) == 0 {
+		return fmt.Errorf("port-forward to %s has no local port", key)
+	}
+	forward.LocalPort = int(ports[0].Local)
+
+	return nil
+}
+
+// List returns the active port-forwards sorted by namespace, pod and port.
+func (c *PortForwardCache) List() []*PortForward {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	forwards := make([]*PortForward, 0, len(c.forwards))
+	for _, forward := range c.forwards {
+		if forward.started() {
+			forwards = append(forwards, forward)
+		}
+	}
+	sort.Slice(forwards, func(i, j int) bool {
+		return portForwardKey(forwards[i].Namespace, forwards[i].Pod, forwards[i].Port) < portForwardKey(forwards[j].Namespace, forwards[j].Pod, forwards[j].Port)
+	})
+	return forwards
+}
+
+// StopPortForward stops the port-forward to the pod port, one that is still starting fails to start.
+// It returns false if none is active.
+func (c *PortForwardCache) StopPortForward(namespace, pod string, port int) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := portForwardKey(namespace, pod, port)
+	forward, ok := c.forwards[key]
+	if !ok {
+		return false
+	}
+	forward.stop()
+	delete(c.forwards, key)
+	return true
+}
+
+// Stop stops every port-forward of the session, it is called when the session is deleted or expires.
+func (c *PortForwardCache) Stop() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.stopped = true
+	for key, forward := range c.forwards {
+		forward.stop()
+		delete(c.forwards, key)
+	}
+}
+
+// portForwardLogWriter logs the errors of a port-forward, for example a connection refused by the pod
+type portForwardLogWriter struct {
+	prefix string
+}
+
+func (w *portForwardLogWriter) Write(p []byte) (int, error) {
+	log.Print(w.prefix + strings.TrimSpace(string(p)))
+	return len(p), nil
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// NewRemoteExecutor returns an executor for the exec or attach URL that speaks the WebSocket protocol,
+// falling back to SPDY when the API server can't upgrade to it.
+func NewRemoteExecutor(config *rest.Config, url *url.URL) (remotecommand.Executor, error) {
+	spdyExecutor, err := remotecommand.NewSPDYExecutor(config, "POST", url)
+	if err != nil {
+		return nil, err
+	}
+	websocketExecutor, err := remotecommand.NewWebSocketExecutor(config, "GET", url.String())
+	if err != nil {
+		return nil, err
+	}
+	return remotecommand.NewFallbackExecutor(websocketExecutor, spdyExecutor, httpstream.IsUpgradeFailure)
+}
+
+// StreamPodExec runs the command in the container with the given streams, until the command exits or the context is canceled.
+// Only the streams that are set are requested, a TTY merges stderr into stdout.
+func StreamPodExec(ctx context.Context, userData *UserData, namespace, podName, containerName string, command []string, streamOptions remotecommand.StreamOptions) error {
+	// Check if clientset is properly initialized
+	if userData.Clientset == nil || userData.RestConfig == nil {
+		return fmt.Errorf("clientset is nil, clientset not properly initialized")
+	}
+
+	req := userData.Clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: containerName,
+			Command:   command,
+			Stdin:     streamOptions.Stdin != nil,
+			Stdout:    streamOptions.Stdout != nil,
+			Stderr:    streamOptions.Stderr != nil,
+			TTY:       streamOptions.Tty,
+		}, scheme.ParameterCodec)
+
+	executor, err := NewRemoteExecutor(userData.RestConfig, req.URL())
+	if err != nil {
+		return err
+	}
+
+	return executor.StreamWithContext(ctx, streamOptions)
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ResourceInformer is a shared informer that tracks whether its watch is interrupted.
+// The reflector behind it already resumes from the last resourceVersion, relists on 410 Gone and
+// requests bookmarks, so subscribers are only told when the watch cannot be re-established.
+type ResourceInformer struct {
+	cache.SharedIndexInformer
+	watchErr       error
+	statusHandlers map[int]*watchStatusHandler
+	nextHandlerID  int
+	mutex          sync.Mutex
+}
+
+// watchStatusHandler delivers the status changes to one handler in the order they happened, from its own
+// goroutine so slow subscribers never block the reflector. pending is guarded by the informer's mutex.
+type watchStatusHandler struct {
+	handler func(err error)
+	pending []error
+	wakeCh  chan struct{}
+}
+
+// newResourceInformer creates the informer over the lister watcher, which it wraps to learn when the reflector
+// has re-established an interrupted watch.
+func newResourceInformer(listWatch cache.ListerWatcher, exampleObject runtime.Object) *ResourceInformer {
+	resourceInformer := &ResourceInformer{
+		statusHandlers: make(map[int]*watchStatusHandler),
+	}
+	resourceInformer.SharedIndexInformer = cache.NewSharedIndexInformer(
+		&resumingListerWatcher{ListerWatcher: listWatch, onWatchStarted: resourceInformer.handleWatchStarted},
+		exampleObject,
+		0,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+	)
+	// The watch error handler can only be set before the informer is started
+	resourceInformer.SetWatchErrorHandler(resourceInformer.handleWatchError)
+	return resourceInformer
+}
+
+// resumingListerWatcher reports every watch the reflector starts. The reflector only watches after a successful
+// list or from a still valid resourceVersion, so a started watch means the informer is live again.
+type resumingListerWatcher struct {
+	cache.ListerWatcher
+	onWatchStarted func()
+}
+
+func (lw *resumingListerWatcher) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	w, err := lw.ListerWatcher.Watch(options)
+	if err == nil {
+		lw.onWatchStarted()
+	}
+	return w, err
+}
+
+// AddWatchStatusHandler registers a handler called with the error when the watch gets interrupted
+// and with nil once it has resumed, in that order. It returns the function removing the handler and
+// the error the watch is interrupted with at registration, nil while it is healthy.
+func (i *ResourceInformer) AddWatchStatusHandler(handler func(err error)) (func(), error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	id := i.nextHandlerID
+	i.nextHandlerID++
+	statusHandler := &watchStatusHandler{handler: handler, wakeCh: make(chan struct{}, 1)}
+	i.statusHandlers[id] = statusHandler
+	go i.runStatusHandler(statusHandler)
+
+	return func() {
+		i.mutex.Lock()
+		defer i.mutex.Unlock()
+		if _, ok := i.statusHandlers[id]; ok {
+			delete(i.statusHandlers, id)
+			close(statusHandler.wakeCh)
+		}
+	}, i.watchErr
+}
+
+// runStatusHandler calls the handler with the pending status changes until the handler is removed
+func (i *ResourceInformer) runStatusHandler(statusHandler *watchStatusHandler) {
+	for range statusHandler.wakeCh {
+		for {
+			i.mutex.Lock()
+			if len(statusHandler.pending) == 0 {
+				i.mutex.Unlock()
+				break
+			}
+			err := statusHandler.pending[0]
+			statusHandler.pending = statusHandler.pending[1:]
+			i.mutex.Unlock()
+
+			statusHandler.handler(err)
+		}
+	}
+}
+
+func (i *ResourceInformer) handleWatchError(r *cache.Reflector, err error) {
+	cache.DefaultWatchErrorHandler(r, err)
+
+	// Expired watches and 410 Gone are resumed or relisted by the reflector on its own
+	if isRoutineWatchError(err) {
+		return
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	alreadyInterrupted := i.watchErr != nil
+	i.watchErr = err
+	if !alreadyInterrupted {
+		i.notifyStatusHandlersLocked(err)
+	}
+}
+
+// handleWatchStarted is called by the reflector whenever it starts a watch, it resumes an interrupted informer
+// even when nothing changed meanwhile and the resourceVersion is the same.
+func (i *ResourceInformer) handleWatchStarted() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	interrupted := i.watchErr != nil
+	i.watchErr = nil
+	if interrupted {
+		i.notifyStatusHandlersLocked(nil)
+	}
+}
+
+// notifyStatusHandlersLocked must be called with the mutex held, in the same critical section as the status
+// change so every handler receives the changes in order
+func (i *ResourceInformer) notifyStatusHandlersLocked(err error) {
+	for _, statusHandler := range i.statusHandlers {
+		statusHandler.pending = append(statusHandler.pending, err)
+		select {
+		case statusHandler.wakeCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func isRoutineWatchError(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ResourceSelector holds the label and field selectors applied server-side on list and watch requests.
+type ResourceSelector struct {
+	LabelSelector string
+	FieldSelector string
+}
+
+// GetResourceSelector reads the labelSelector and fieldSelector query parameters,
+// e.g. ?labelSelector=app=checkout&fieldSelector=status.phase=Running
+func GetResourceSelector(r *http.Request) (ResourceSelector, error) {
+	return NewResourceSelector(r.URL.Query().Get("labelSelector"), r.URL.Query().Get("fieldSelector"))
+}
+
+// NewResourceSelector validates the label and field selectors, empty selectors match everything.
+func NewResourceSelector(labelSelector, fieldSelector string) (ResourceSelector, error) {
+	if _, err := labels.Parse(labelSelector); err != nil {
+		return ResourceSelector{}, fmt.Errorf("invalid labelSelector: %s", err.Error())
+	}
+	if _, err := fields.ParseSelector(fieldSelector); err != nil {
+		return ResourceSelector{}, fmt.Errorf("invalid fieldSelector: %s", err.Error())
+	}
+
+	return ResourceSelector{LabelSelector: labelSelector, FieldSelector: fieldSelector}, nil
+}
+
+// ApplyToListOptions sets the selectors on list or watch options.
+func (s ResourceSelector) ApplyToListOptions(options *metav1.ListOptions) {
+	options.LabelSelector = s.LabelSelector
+	options.FieldSelector = s.FieldSelector
+}
+
+// ListOptions returns list or watch options filtered by the selectors.
+func (s ResourceSelector) ListOptions() metav1.ListOptions {
+	options := metav1.ListOptions{}
+	s.ApplyToListOptions(&options)
+	return options
+}
+
+func (s ResourceSelector) String() string {
+	return fmt.Sprintf("labelSelector=%s&fieldSelector=%s", s.LabelSelector, s.FieldSelector)
+}
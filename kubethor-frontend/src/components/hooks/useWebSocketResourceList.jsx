@@ -9,6 +9,7 @@ const useWebSocketResourceList = (
 ) => {
   const [wsStatus, setWsStatus] = useState("disconnected");
   const [data, setData] = useState([]);
+  const [synced, setSynced] = useState(false);
   const [shouldConnectWebSocket, setShouldConnectWebSocket] = useState(true);
   const sessionId = sessionStorage.getItem(KubethorUserSessionId);
 
@@ -17,6 +18,7 @@ const useWebSocketResourceList = (
 
     const connectWebSocket = () => {
       setWsStatus("connecting");
+      setSynced(false);
       socket = new WebSocket(`${WS_URL}?sessionId=${sessionId}`);
 
       socket.onopen = () => {
@@ -42,14 +44,30 @@ const useWebSocketResourceList = (
           } else {
             // If no error
             setClientCurrentNamepaceError("");
-            if (parsedData.eventType === "DELETED") {
+            if (parsedData.eventType === "SYNCED") {
+              // Initial list is complete, following messages are incremental
+              setSynced(true);
+            } else if (parsedData.eventType === "LAGGING") {
+              // Fell behind, a fresh snapshot and SYNCED follow
+              setSynced(false);
+              setData([]);
+            } else if (parsedData.eventType === "RESUMED") {
+              // Interrupted watch is back, missed changes follow as regular events
+            } else if (parsedData.eventType === "DELETED") {
               setData((prevData) =>
-                prevData.filter((item) => item.name !== parsedData.name)
+                prevData.filter(
+                  (item) =>
+                    item.name !== parsedData.name ||
+                    item.namespace !== parsedData.namespace
+                )
               );
             } else {
               setData((prevData) => {
+                // Items are keyed by namespace too, "_all" streams every namespace
                 const existingIndex = prevData.findIndex(
-                  (item) => item.name === parsedData.name
+                  (item) =>
+                    item.name === parsedData.name &&
+                    item.namespace === parsedData.namespace
                 );
                 if (existingIndex !== -1) {
                   prevData[existingIndex] = parsedData;
@@ -103,7 +121,7 @@ const useWebSocketResourceList = (
     };
   }, [clientCurrentNamepace]);
 
-  return { wsStatus, data };
+  return { wsStatus, data, synced };
 };
 
 export default useWebSocketResourceList;